@@ -0,0 +1,154 @@
+package loadshed
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tcpListenState is the state of a listening socket in /proc/net/tcp.
+const tcpListenState = "0A"
+
+// listenAddr identifies a listening socket. A nil ip matches any address.
+type listenAddr struct {
+	ip   net.IP
+	port uint16
+}
+
+func (l listenAddr) matches(ip net.IP, port uint16) bool {
+	return port == l.port && (l.ip == nil || l.ip.Equal(ip))
+}
+
+// parseListenAddr parses an address such as ":8080" or "127.0.0.1:8080".
+// Unspecified addresses, such as "0.0.0.0:8080", match every listening socket
+// on the port.
+func parseListenAddr(addr string) (listenAddr, error) {
+	var host, portString, e = net.SplitHostPort(addr)
+	if e != nil {
+		return listenAddr{}, e
+	}
+	var port, perr = strconv.ParseUint(portString, 10, 16)
+	if perr != nil {
+		return listenAddr{}, fmt.Errorf("invalid port in %s: %s", addr, perr)
+	}
+	var result = listenAddr{port: uint16(port)}
+	if host == "" {
+		return result, nil
+	}
+	result.ip = net.ParseIP(host)
+	if result.ip == nil {
+		return listenAddr{}, fmt.Errorf("invalid ip in %s", addr)
+	}
+	if result.ip.IsUnspecified() {
+		result.ip = nil
+	}
+	return result, nil
+}
+
+// parseProcNetAddr parses an address from /proc/net/tcp or /proc/net/tcp6
+// such as "0100007F:1F90". The address is written as a sequence of 32 bit
+// words in host byte order, which is little endian on supported platforms.
+func parseProcNetAddr(s string) (net.IP, uint16, error) {
+	var parts = strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+	var b, e = hex.DecodeString(parts[0])
+	if e != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+	for x := 0; x < len(b); x = x + 4 {
+		b[x], b[x+1], b[x+2], b[x+3] = b[x+3], b[x+2], b[x+1], b[x]
+	}
+	var port, perr = strconv.ParseUint(parts[1], 16, 16)
+	if perr != nil {
+		return nil, 0, fmt.Errorf("invalid port in %q: %s", s, perr)
+	}
+	return net.IP(b), uint16(port), nil
+}
+
+// parseAcceptQueue sums the accept queue depth of the listening sockets in
+// the content of /proc/net/tcp or /proc/net/tcp6 that match the address. For
+// listening sockets the rx_queue column is the number of established
+// connections waiting to be accepted.
+func parseAcceptQueue(content string, want listenAddr) (float64, error) {
+	var total = 0.0
+	for _, line := range strings.Split(content, "\n") {
+		var fields = strings.Fields(line)
+		if len(fields) < 5 || fields[3] != tcpListenState {
+			continue
+		}
+		var ip, port, e = parseProcNetAddr(fields[1])
+		if e != nil {
+			return 0, e
+		}
+		if !want.matches(ip, port) {
+			continue
+		}
+		var queues = strings.SplitN(fields[4], ":", 2)
+		if len(queues) != 2 {
+			return 0, fmt.Errorf("invalid queues %q", fields[4])
+		}
+		var rx, perr = strconv.ParseUint(queues[1], 16, 64)
+		if perr != nil {
+			return 0, fmt.Errorf("invalid rx_queue %q: %s", fields[4], perr)
+		}
+		total = total + float64(rx)
+	}
+	return total, nil
+}
+
+// acceptQueueSample generates a sample function that reports the accept
+// queue depth of the listening sockets that match the address. Both IPv4 and
+// IPv6 sockets are read from the proc filesystem mounted at procRoot.
+func acceptQueueSample(procRoot string, want listenAddr) func() (float64, error) {
+	var paths = []string{
+		filepath.Join(procRoot, "net", "tcp"),
+		filepath.Join(procRoot, "net", "tcp6"),
+	}
+	return func() (float64, error) {
+		var total = 0.0
+		var found = false
+		for _, path := range paths {
+			var b, e = os.ReadFile(path)
+			if os.IsNotExist(e) {
+				continue
+			}
+			if e != nil {
+				return 0, e
+			}
+			found = true
+			var depth, perr = parseAcceptQueue(string(b), want)
+			if perr != nil {
+				return 0, perr
+			}
+			total = total + depth
+		}
+		if !found {
+			return 0, fmt.Errorf("no tcp socket tables found in %s", procRoot)
+		}
+		return total, nil
+	}
+}
+
+// newListenBacklog tracks a rolling average of the accept queue depth of the
+// listening sockets that match the address. If the address is invalid then
+// every sample fails with the parsing error.
+func newListenBacklog(addr string, procRoot string, pollingInterval time.Duration, windowSize int) *polledAverage {
+	if procRoot == "" {
+		procRoot = defaultProcRoot
+	}
+	var sample func() (float64, error)
+	var want, e = parseListenAddr(addr)
+	if e != nil {
+		sample = failingSample(e)
+	} else {
+		sample = acceptQueueSample(procRoot, want)
+	}
+	return newPolledAverage("AverageListenBacklog", pollingInterval, windowSize, sample)
+}
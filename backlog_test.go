@@ -0,0 +1,117 @@
+package loadshed
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+var tcpFixture = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000080:00000003 00:00000000 00000000  1000        0 100 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F91 00000000:0000 0A 00000080:00000004 00:00000000 00000000  1000        0 101 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:1F90 0100007F:D431 01 00000000:00000009 00:00000000 00000000  1000        0 102 1 0000000000000000 20 4 30 10 -1
+`
+
+var tcp6Fixture = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F90 00000000000000000000000000000000:0000 0A 00000080:00000002 00:00000000 00000000  1000        0 200 1 0000000000000000 100 0 0 10 0
+   1: 00000000000000000000000001000000:1F91 00000000000000000000000000000000:0000 0A 00000080:00000005 00:00000000 00000000  1000        0 201 1 0000000000000000 100 0 0 10 0
+`
+
+func TestParseListenAddr(t *testing.T) {
+	var tc = []struct {
+		addr string
+		ip   net.IP
+		port uint16
+	}{
+		{":8080", nil, 8080},
+		{"0.0.0.0:8080", nil, 8080},
+		{"[::]:8080", nil, 8080},
+		{"127.0.0.1:8081", net.ParseIP("127.0.0.1"), 8081},
+		{"[::1]:8081", net.ParseIP("::1"), 8081},
+	}
+	for _, c := range tc {
+		var l, e = parseListenAddr(c.addr)
+		if e != nil {
+			t.Fatalf("%s: %s", c.addr, e)
+		}
+		if l.port != c.port || !l.ip.Equal(c.ip) {
+			t.Fatalf("%s: unexpected result %v", c.addr, l)
+		}
+	}
+	for _, addr := range []string{"8080", "localhost:8080", ":http", ":70000"} {
+		if _, e := parseListenAddr(addr); e == nil {
+			t.Fatalf("%s: expected error", addr)
+		}
+	}
+}
+
+func TestParseProcNetAddr(t *testing.T) {
+	var ip, port, e = parseProcNetAddr("0100007F:1F90")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !ip.Equal(net.ParseIP("127.0.0.1")) || port != 8080 {
+		t.Fatalf("unexpected address %s:%d", ip, port)
+	}
+	ip, port, e = parseProcNetAddr("00000000000000000000000001000000:1F91")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !ip.Equal(net.ParseIP("::1")) || port != 8081 {
+		t.Fatalf("unexpected address %s:%d", ip, port)
+	}
+	for _, s := range []string{"0100007F", "0100:1F90", "0100007F:ZZZZ", "ZZ00007F:1F90"} {
+		if _, _, e = parseProcNetAddr(s); e == nil {
+			t.Fatalf("%s: expected error", s)
+		}
+	}
+}
+
+func TestListenBacklog(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "net/tcp", tcpFixture)
+	writeFixture(t, root, "net/tcp6", tcp6Fixture)
+	var tc = []struct {
+		addr     string
+		expected float64
+	}{
+		{":8080", 5},
+		{"0.0.0.0:8080", 5},
+		{"127.0.0.1:8080", 0},
+		{"127.0.0.1:8081", 4},
+		{"[::1]:8081", 5},
+		{":8081", 9},
+		{":9090", 0},
+	}
+	for _, c := range tc {
+		var want, e = parseListenAddr(c.addr)
+		if e != nil {
+			t.Fatal(e)
+		}
+		var p = newPolledAverage("test", time.Second, 1, acceptQueueSample(root, want))
+		p.feed()
+		if p.Aggregate().Value != c.expected {
+			t.Fatalf("%s: expected backlog %f got %f", c.addr, c.expected, p.Aggregate().Value)
+		}
+	}
+}
+
+func TestListenBacklogErrors(t *testing.T) {
+	var want, _ = parseListenAddr(":8080")
+	var root = t.TempDir()
+	if _, e := acceptQueueSample(root, want)(); e == nil {
+		t.Fatal("expected error from missing tables")
+	}
+	writeFixture(t, root, "net/tcp", "   0: 00000000:1F90 00000000:0000 0A 00000080\n")
+	if _, e := acceptQueueSample(root, want)(); e == nil {
+		t.Fatal("expected error from malformed queues")
+	}
+	writeFixture(t, root, "net/tcp", "   0: 00000000:1F90 00000000:0000 0A 00000080:ZZ\n")
+	if _, e := acceptQueueSample(root, want)(); e == nil {
+		t.Fatal("expected error from malformed rx_queue")
+	}
+	writeFixture(t, root, "net/tcp", "   0: 0000:1F90 00000000:0000 0A 00000080:00000001\n")
+	if _, e := acceptQueueSample(root, want)(); e == nil {
+		t.Fatal("expected error from malformed address")
+	}
+}
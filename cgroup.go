@@ -0,0 +1,245 @@
+package loadshed
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCgroupRoot is where the cgroup filesystem is mounted on most Linux
+// systems. Inside a container with a cgroup namespace this is the cgroup of
+// the container.
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroupUnlimited is the smallest value treated as no limit. cgroup v1
+// reports an unlimited memory limit as a very large page aligned number.
+const cgroupUnlimited = uint64(1) << 62
+
+// readCgroupUint reads a file containing a single unsigned integer. The value
+// "max" is interpreted as no limit and returned as zero.
+func readCgroupUint(path string) (uint64, error) {
+	var b, e = os.ReadFile(path)
+	if e != nil {
+		return 0, e
+	}
+	var s = strings.TrimSpace(string(b))
+	if s == "max" {
+		return 0, nil
+	}
+	var v, perr = strconv.ParseUint(s, 10, 64)
+	if perr != nil {
+		return 0, fmt.Errorf("invalid value in %s: %s", path, perr)
+	}
+	if v >= cgroupUnlimited {
+		return 0, nil
+	}
+	return v, nil
+}
+
+// cgroupMemoryLimit reads the memory limit, in bytes, of the cgroup mounted at
+// root. Both cgroup v2 (memory.max) and v1 (memory/memory.limit_in_bytes) are
+// supported. A limit of zero means the cgroup is unlimited.
+func cgroupMemoryLimit(root string) (uint64, error) {
+	var limit, e = readCgroupUint(filepath.Join(root, "memory.max"))
+	if e == nil {
+		return limit, nil
+	}
+	return readCgroupUint(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+}
+
+// cgroupCPUStat is a snapshot of the CPU accounting of a cgroup.
+type cgroupCPUStat struct {
+	usage         time.Duration
+	periods       uint64
+	throttled     uint64
+	throttledTime time.Duration
+}
+
+// readCgroupKeyed reads a file of "key value" lines, such as cpu.stat.
+func readCgroupKeyed(path string) (map[string]uint64, error) {
+	var b, e = os.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+	var values = make(map[string]uint64)
+	for _, line := range strings.Split(string(b), "\n") {
+		var fields = strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		var v, perr = strconv.ParseUint(fields[1], 10, 64)
+		if perr != nil {
+			return nil, fmt.Errorf("invalid value for %s in %s: %s", fields[0], path, perr)
+		}
+		values[fields[0]] = v
+	}
+	return values, nil
+}
+
+// readCgroupCPUStat reads the CPU accounting of the cgroup mounted at root.
+// Both cgroup v2 (cpu.stat) and v1 (cpuacct/cpuacct.usage and cpu/cpu.stat)
+// are supported.
+func readCgroupCPUStat(root string) (cgroupCPUStat, error) {
+	var v2, e = readCgroupKeyed(filepath.Join(root, "cpu.stat"))
+	if e == nil {
+		if usage, ok := v2["usage_usec"]; ok {
+			return cgroupCPUStat{
+				usage:         time.Duration(usage) * time.Microsecond,
+				periods:       v2["nr_periods"],
+				throttled:     v2["nr_throttled"],
+				throttledTime: time.Duration(v2["throttled_usec"]) * time.Microsecond,
+			}, nil
+		}
+	}
+	var usage, uerr = readCgroupUint(filepath.Join(root, "cpuacct", "cpuacct.usage"))
+	if uerr != nil {
+		return cgroupCPUStat{}, uerr
+	}
+	var v1, serr = readCgroupKeyed(filepath.Join(root, "cpu", "cpu.stat"))
+	if serr != nil {
+		return cgroupCPUStat{}, serr
+	}
+	return cgroupCPUStat{
+		usage:         time.Duration(usage),
+		periods:       v1["nr_periods"],
+		throttled:     v1["nr_throttled"],
+		throttledTime: time.Duration(v1["throttled_time"]),
+	}, nil
+}
+
+// cgroupCPUQuota reads the CPU quota of the cgroup mounted at root as a number
+// of cores. Both cgroup v2 (cpu.max) and v1 (cpu/cpu.cfs_quota_us and
+// cpu/cpu.cfs_period_us) are supported. A quota of zero means the cgroup is
+// unlimited, which includes the root cgroup that has no quota files.
+func cgroupCPUQuota(root string) (float64, error) {
+	var b, e = os.ReadFile(filepath.Join(root, "cpu.max"))
+	if e != nil && !os.IsNotExist(e) {
+		return 0, e
+	}
+	if e == nil {
+		var fields = strings.Fields(string(b))
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("invalid cpu.max: %q", string(b))
+		}
+		if fields[0] == "max" {
+			return 0, nil
+		}
+		var quota, qerr = strconv.ParseFloat(fields[0], 64)
+		if qerr != nil {
+			return 0, fmt.Errorf("invalid cpu.max quota: %s", qerr)
+		}
+		var period, perr = strconv.ParseFloat(fields[1], 64)
+		if perr != nil || period <= 0 {
+			return 0, fmt.Errorf("invalid cpu.max period: %q", fields[1])
+		}
+		return quota / period, nil
+	}
+	var qb, qerr = os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if os.IsNotExist(qerr) {
+		return 0, nil
+	}
+	if qerr != nil {
+		return 0, qerr
+	}
+	var quota, perr = strconv.ParseInt(strings.TrimSpace(string(qb)), 10, 64)
+	if perr != nil {
+		return 0, fmt.Errorf("invalid cpu.cfs_quota_us: %s", perr)
+	}
+	if quota < 0 {
+		return 0, nil
+	}
+	var period, err = readCgroupUint(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, err
+	}
+	if period == 0 {
+		return 0, fmt.Errorf("invalid cpu.cfs_period_us: 0")
+	}
+	return float64(quota) / float64(period), nil
+}
+
+// cgroupCPUDelta describes the CPU activity of a cgroup between two samples.
+type cgroupCPUDelta struct {
+	// usage is the CPU time consumed.
+	usage time.Duration
+	// elapsed is the wall clock time between the samples.
+	elapsed time.Duration
+	// throttled is the percentage of enforcement periods that were throttled.
+	throttled float64
+	// periods is the number of enforcement periods that elapsed.
+	periods uint64
+	// throttledPeriods is the number of enforcement periods that were
+	// throttled.
+	throttledPeriods uint64
+	// throttledTime is the time spent throttled.
+	throttledTime time.Duration
+}
+
+// errNoBaseline is returned by samplers that compute the difference between
+// consecutive readings when no previous reading exists.
+var errNoBaseline = errors.New("no previous sample to compare against")
+
+// cgroupCPUSampler computes the CPU activity of a cgroup between consecutive
+// calls to sample.
+type cgroupCPUSampler struct {
+	root     string
+	now      func() time.Time
+	cores    func() int
+	last     cgroupCPUStat
+	lastTime time.Time
+}
+
+func (s *cgroupCPUSampler) sample() (cgroupCPUDelta, error) {
+	var now = s.now()
+	var stat, e = readCgroupCPUStat(s.root)
+	if e != nil {
+		return cgroupCPUDelta{}, e
+	}
+	var last, lastTime = s.last, s.lastTime
+	s.last, s.lastTime = stat, now
+	var elapsed = now.Sub(lastTime)
+	// Counters that move backwards indicate the cgroup was recreated.
+	if lastTime.IsZero() || elapsed <= 0 || stat.usage < last.usage || stat.periods < last.periods || stat.throttled < last.throttled {
+		return cgroupCPUDelta{}, errNoBaseline
+	}
+	var d = cgroupCPUDelta{
+		usage:            stat.usage - last.usage,
+		elapsed:          elapsed,
+		periods:          stat.periods - last.periods,
+		throttledPeriods: stat.throttled - last.throttled,
+		throttledTime:    stat.throttledTime - last.throttledTime,
+	}
+	if d.periods > 0 {
+		d.throttled = float64(d.throttledPeriods) / float64(d.periods) * 100
+	}
+	return d, nil
+}
+
+// usage converts the CPU time consumed within the delta to a percentage of the
+// quota of the cgroup. The number of cores of the host is used when the cgroup
+// has no quota. The quota is only read here so that measurements which do not
+// depend on it, such as throttling, never fail because of it.
+func (s *cgroupCPUSampler) usage(d cgroupCPUDelta) (float64, error) {
+	var quota, e = cgroupCPUQuota(s.root)
+	if e != nil {
+		return 0, e
+	}
+	if quota == 0 {
+		quota = float64(s.cores())
+	}
+	return d.usage.Seconds() / (d.elapsed.Seconds() * quota) * 100, nil
+}
+
+// newCgroupCPUSampler generates a sampler for the cgroup mounted at root. An
+// empty root uses the default mount point.
+func newCgroupCPUSampler(root string) *cgroupCPUSampler {
+	if root == "" {
+		root = defaultCgroupRoot
+	}
+	return &cgroupCPUSampler{root: root, now: time.Now, cores: runtime.NumCPU}
+}
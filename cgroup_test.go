@@ -0,0 +1,206 @@
+package loadshed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFixture writes a file, and any missing parent directories, beneath the
+// given root.
+func writeFixture(t *testing.T, root string, name string, content string) {
+	var path = filepath.Join(root, name)
+	if e := os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.WriteFile(path, []byte(content), 0644); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestCgroupMemoryLimitV2(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "memory.max", "1073741824\n")
+	var limit, e = cgroupMemoryLimit(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if limit != 1073741824 {
+		t.Fatalf("wrong limit %d", limit)
+	}
+	writeFixture(t, root, "memory.max", "max\n")
+	if limit, _ = cgroupMemoryLimit(root); limit != 0 {
+		t.Fatalf("wrong limit %d", limit)
+	}
+}
+
+func TestCgroupMemoryLimitV1(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "memory/memory.limit_in_bytes", "536870912\n")
+	var limit, e = cgroupMemoryLimit(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if limit != 536870912 {
+		t.Fatalf("wrong limit %d", limit)
+	}
+	writeFixture(t, root, "memory/memory.limit_in_bytes", "9223372036854771712\n")
+	if limit, _ = cgroupMemoryLimit(root); limit != 0 {
+		t.Fatalf("wrong limit %d", limit)
+	}
+}
+
+func TestCgroupMemoryLimitMissing(t *testing.T) {
+	var _, e = cgroupMemoryLimit(t.TempDir())
+	if e == nil {
+		t.Fatal("expected error for missing cgroup files")
+	}
+}
+
+func TestCgroupInvalid(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "memory.max", "lots\n")
+	var _, e = cgroupMemoryLimit(root)
+	if e == nil {
+		t.Fatal("expected error for invalid value")
+	}
+}
+
+func writeCPUFixtureV2(t *testing.T, root string, usageUsec int, periods int, throttled int, throttledUsec int) {
+	writeFixture(t, root, "cpu.stat", fmt.Sprintf(
+		"usage_usec %d\nuser_usec 0\nsystem_usec 0\nnr_periods %d\nnr_throttled %d\nthrottled_usec %d\n",
+		usageUsec, periods, throttled, throttledUsec,
+	))
+}
+
+func writeCPUFixtureV1(t *testing.T, root string, usageNsec int, periods int, throttled int, throttledNsec int) {
+	writeFixture(t, root, "cpuacct/cpuacct.usage", fmt.Sprintf("%d\n", usageNsec))
+	writeFixture(t, root, "cpu/cpu.stat", fmt.Sprintf(
+		"nr_periods %d\nnr_throttled %d\nthrottled_time %d\n",
+		periods, throttled, throttledNsec,
+	))
+}
+
+func TestCgroupCPUStatV2(t *testing.T) {
+	var root = t.TempDir()
+	writeCPUFixtureV2(t, root, 1500000, 100, 25, 300000)
+	var stat, e = readCgroupCPUStat(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var expected = cgroupCPUStat{usage: 1500 * time.Millisecond, periods: 100, throttled: 25, throttledTime: 300 * time.Millisecond}
+	if stat != expected {
+		t.Fatalf("wrong stat %+v", stat)
+	}
+}
+
+func TestCgroupCPUStatV1(t *testing.T) {
+	var root = t.TempDir()
+	writeCPUFixtureV1(t, root, 1500000000, 100, 25, 300000000)
+	var stat, e = readCgroupCPUStat(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var expected = cgroupCPUStat{usage: 1500 * time.Millisecond, periods: 100, throttled: 25, throttledTime: 300 * time.Millisecond}
+	if stat != expected {
+		t.Fatalf("wrong stat %+v", stat)
+	}
+}
+
+func TestCgroupCPUQuotaV2(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "cpu.max", "150000 100000\n")
+	var quota, e = cgroupCPUQuota(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if quota != 1.5 {
+		t.Fatalf("wrong quota %f", quota)
+	}
+	writeFixture(t, root, "cpu.max", "max 100000\n")
+	if quota, _ = cgroupCPUQuota(root); quota != 0 {
+		t.Fatalf("wrong quota %f", quota)
+	}
+}
+
+func TestCgroupCPUQuotaV2Root(t *testing.T) {
+	var root = t.TempDir()
+	writeCPUFixtureV2(t, root, 0, 0, 0, 0)
+	var quota, e = cgroupCPUQuota(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if quota != 0 {
+		t.Fatalf("wrong quota %f", quota)
+	}
+}
+
+func TestCgroupCPUQuotaV1(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "cpu/cpu.cfs_quota_us", "50000\n")
+	writeFixture(t, root, "cpu/cpu.cfs_period_us", "100000\n")
+	var quota, e = cgroupCPUQuota(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if quota != .5 {
+		t.Fatalf("wrong quota %f", quota)
+	}
+	writeFixture(t, root, "cpu/cpu.cfs_quota_us", "-1\n")
+	if quota, _ = cgroupCPUQuota(root); quota != 0 {
+		t.Fatalf("wrong quota %f", quota)
+	}
+}
+
+func TestCgroupCPUSampler(t *testing.T) {
+	var root = t.TempDir()
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = newCgroupCPUSampler(root)
+	s.now = clock.Now
+	writeFixture(t, root, "cpu.max", "200000 100000\n")
+	writeCPUFixtureV2(t, root, 0, 0, 0, 0)
+	if _, e := s.sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline: %v", e)
+	}
+	clock.Advance(time.Second)
+	writeCPUFixtureV2(t, root, 1000000, 10, 5, 200000)
+	var d, e = s.sample()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if usage, _ := s.usage(d); usage != 50 {
+		t.Fatalf("wrong usage %f", usage)
+	}
+	if d.throttled != 50 {
+		t.Fatalf("wrong throttled %f", d.throttled)
+	}
+	if d.throttledTime != 200*time.Millisecond {
+		t.Fatalf("wrong throttled time %s", d.throttledTime)
+	}
+}
+
+func TestCgroupCPUSamplerNoQuota(t *testing.T) {
+	var root = t.TempDir()
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = newCgroupCPUSampler(root)
+	s.now = clock.Now
+	s.cores = func() int { return 4 }
+	writeCPUFixtureV1(t, root, 0, 0, 0, 0)
+	writeFixture(t, root, "cpu/cpu.cfs_quota_us", "-1\n")
+	_, _ = s.sample()
+	clock.Advance(time.Second)
+	writeCPUFixtureV1(t, root, 1000000000, 0, 0, 0)
+	var d, e = s.sample()
+	if e != nil {
+		t.Fatal(e)
+	}
+	var usage, uerr = s.usage(d)
+	if uerr != nil {
+		t.Fatal(uerr)
+	}
+	if usage != 25 {
+		t.Fatalf("wrong usage %f", usage)
+	}
+}
@@ -55,11 +55,10 @@ type concurrencyDecorator struct {
 	wg *WaitGroup
 }
 
-func (h *concurrencyDecorator) Wrap(next func() error) func() error {
-	return func() error {
-		h.wg.Add(1)
-		defer h.wg.Done()
-		return next()
+func (h *concurrencyDecorator) Track(cost int) func(error) {
+	h.wg.Add(cost)
+	return func(error) {
+		h.wg.Add(-cost)
 	}
 }
 
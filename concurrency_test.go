@@ -18,7 +18,7 @@ func TestConcurrencyDecorator(t *testing.T) {
 	var wg = NewWaitGroup()
 	var decorator = newConcurrencyTrackingDecorator(wg)
 
-	var d = decorator.Wrap(func() error {
+	var d = wrap(decorator, 1, func() error {
 		if wg.Aggregate().Value != 1 {
 			t.Fatalf("wrong internal count: %f", wg.Aggregate().Value)
 		}
@@ -29,3 +29,19 @@ func TestConcurrencyDecorator(t *testing.T) {
 		t.Fatalf("wrong internal count: %f", wg.Aggregate().Value)
 	}
 }
+
+func TestConcurrencyDecoratorWeighted(t *testing.T) {
+	var wg = NewWaitGroup()
+	var decorator = newConcurrencyTrackingDecorator(wg)
+
+	var d = wrap(decorator, 5, func() error {
+		if wg.Aggregate().Value != 5 {
+			t.Fatalf("wrong internal count: %f", wg.Aggregate().Value)
+		}
+		return nil
+	})
+	_ = d()
+	if wg.Aggregate().Value != 0 {
+		t.Fatalf("wrong internal count: %f", wg.Aggregate().Value)
+	}
+}
@@ -0,0 +1,43 @@
+package loadshed
+
+import (
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// containerCPU is a rolling average Aggregator for the CPU usage of a cgroup
+// as a percentage of its quota. The rolling average of the percentage of
+// throttled periods is reported as the source of the aggregate.
+type containerCPU struct {
+	usage     *polledAverage
+	throttled rolling.Rollup
+}
+
+// Name emits the rollup name for identification.
+func (c *containerCPU) Name() string {
+	return c.usage.Name()
+}
+
+// Aggregate emits the current rolling average of container CPU usage.
+func (c *containerCPU) Aggregate() *rolling.Aggregate {
+	var a = c.usage.Aggregate()
+	a.Source = c.throttled.Aggregate()
+	return a
+}
+
+// newContainerCPU tracks a rolling average of the CPU consumption reported by
+// the sampler. The time window is defined as windowSize * pollingInterval. The
+// poller must be started separately.
+func newContainerCPU(sampler *cgroupCPUSampler, pollingInterval time.Duration, windowSize int) *containerCPU {
+	var w = rolling.NewPointWindow(windowSize)
+	var usage = newPolledAverage("AverageContainerCPU", pollingInterval, windowSize, func() (float64, error) {
+		var d, e = sampler.sample()
+		if e != nil {
+			return 0, e
+		}
+		w.Feed(d.throttled)
+		return sampler.usage(d)
+	})
+	return &containerCPU{usage: usage, throttled: rolling.NewAverageRollup(w, "AverageContainerCPUThrottled")}
+}
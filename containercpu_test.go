@@ -0,0 +1,32 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContainerCPU(t *testing.T) {
+	var root = t.TempDir()
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = newCgroupCPUSampler(root)
+	s.now = clock.Now
+	var c = newContainerCPU(s, time.Second, 1)
+
+	writeFixture(t, root, "cpu.max", "100000 100000\n")
+	writeCPUFixtureV2(t, root, 0, 0, 0, 0)
+	c.usage.feed()
+	clock.Advance(time.Second)
+	writeCPUFixtureV2(t, root, 750000, 10, 2, 0)
+	c.usage.feed()
+
+	var a = c.Aggregate()
+	if a.Value != 75 {
+		t.Fatalf("wrong usage %f", a.Value)
+	}
+	if a.Source == nil || a.Source.Value != 20 {
+		t.Fatalf("wrong throttling source %+v", a.Source)
+	}
+	if c.Name() != "AverageContainerCPU" {
+		t.Fatalf("wrong name %s", c.Name())
+	}
+}
@@ -0,0 +1,38 @@
+package loadshed
+
+import "context"
+
+type ctxKey string
+
+var costKey = ctxKey("loadshedcost")
+var decisionKey = ctxKey("loadsheddecision")
+
+// NewCostContext inserts the cost of a call into the context. The cost is
+// used by Acquire in the same way as the cost given to DoWeighted.
+func NewCostContext(ctx context.Context, cost int) context.Context {
+	return context.WithValue(ctx, costKey, cost)
+}
+
+// CostFromContext extracts the cost of a call from the context. If no cost
+// is set, or the cost is less than one, then one is returned.
+func CostFromContext(ctx context.Context) int {
+	if v, ok := ctx.Value(costKey).(int); ok && v > 0 {
+		return v
+	}
+	return 1
+}
+
+// NewDecisionContext inserts the Decision that admitted a call into the
+// context.
+func NewDecisionContext(ctx context.Context, d *Decision) context.Context {
+	return context.WithValue(ctx, decisionKey, d)
+}
+
+// DecisionFromContext extracts the Decision that admitted a call from the
+// context. It returns nil if the call was not made with DoContext.
+func DecisionFromContext(ctx context.Context) *Decision {
+	if v, ok := ctx.Value(decisionKey).(*Decision); ok {
+		return v
+	}
+	return nil
+}
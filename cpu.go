@@ -1,46 +1,82 @@
 package loadshed
 
 import (
+	"fmt"
 	"time"
 
-	"github.com/asecurityteam/rolling"
 	pscpu "github.com/shirou/gopsutil/cpu"
 )
 
-// avgCPU is a rolling average Aggregator for avgCPU usage of a host.
-type avgCPU struct {
-	pollingInterval time.Duration
-	feeder          rolling.Feeder
-	rollup          rolling.Rollup
+// Sampler is a source of point in time values, such as resource usage, that
+// are polled and aggregated by an option.
+type Sampler interface {
+	// Sample returns the current value. Samples that return an error are
+	// skipped.
+	Sample() (float64, error)
 }
 
-func (c *avgCPU) poll() {
-	for {
-		c.feed()
+// SamplerFunc adapts a function to the Sampler interface.
+type SamplerFunc func() (float64, error)
+
+// Sample calls the underlying function.
+func (f SamplerFunc) Sample() (float64, error) {
+	return f()
+}
+
+// hostCPUSampler reports the percentage of time, between 0 and 100, that the
+// host CPUs were busy since the previous sample. It never blocks.
+type hostCPUSampler struct {
+	times func() ([]pscpu.TimesStat, error)
+	last  *pscpu.TimesStat
+}
+
+func (s *hostCPUSampler) Sample() (float64, error) {
+	var times, e = s.times()
+	if e != nil {
+		return 0, e
 	}
+	if len(times) < 1 {
+		return 0, fmt.Errorf("no cpu times reported")
+	}
+	var current = times[0]
+	var last = s.last
+	s.last = &current
+	if last == nil {
+		return 0, errNoBaseline
+	}
+	return cpuBusy(*last, current)
 }
 
-func (c *avgCPU) feed() {
-	var pctUsed, _ = pscpu.Percent(c.pollingInterval, false)
-	c.feeder.Feed(pctUsed[0])
+// cpuBusy computes the percentage of time, between 0 and 100, that a CPU was
+// busy between two readings of its times.
+func cpuBusy(last pscpu.TimesStat, current pscpu.TimesStat) (float64, error) {
+	var total = current.Total() - last.Total()
+	if total <= 0 {
+		return 0, fmt.Errorf("cpu times did not advance")
+	}
+	var idle = (current.Idle + current.Iowait) - (last.Idle + last.Iowait)
+	return clampPercent((total - idle) / total * 100), nil
 }
 
-// Name emits the rollup name for identification.
-func (c *avgCPU) Name() string {
-	return c.rollup.Name()
+// newHostCPUSampler generates the default Sampler for the CPU option which
+// reads the CPU times of the host using gopsutil.
+func newHostCPUSampler() *hostCPUSampler {
+	return &hostCPUSampler{times: func() ([]pscpu.TimesStat, error) { return pscpu.Times(false) }}
 }
 
-// Aggregate emits the current rolling average of avgCPU usage
-func (c *avgCPU) Aggregate() *rolling.Aggregate {
-	return c.rollup.Aggregate()
+// clampPercent bounds a percentage to the range 0 to 100.
+func clampPercent(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		return 100
+	}
+	return v
 }
 
-// newavgCPU tracks a rolling average of avgCPU consumption. The time window is
-// defined as windowSize * pollingInterval.
-func newAvgCPU(pollingInterval time.Duration, windowSize int) *avgCPU {
-	var w = rolling.NewPointWindow(windowSize)
-	var a = rolling.NewAverageRollup(w, "AverageCPU")
-	var result = &avgCPU{pollingInterval, w, a}
-	go result.poll()
-	return result
+// newAvgCPU tracks a rolling average of CPU consumption reported by the
+// sampler. The time window is defined as windowSize * pollingInterval.
+func newAvgCPU(sampler Sampler, pollingInterval time.Duration, windowSize int) *polledAverage {
+	return newPolledAverage("AverageCPU", pollingInterval, windowSize, sampler.Sample)
 }
@@ -1,52 +1,108 @@
 package loadshed
 
 import (
-	"math"
+	"fmt"
 	"testing"
 	"time"
 
-	"github.com/asecurityteam/rolling"
+	pscpu "github.com/shirou/gopsutil/cpu"
 )
 
+// sequenceSampler replays a fixed sequence of CPU values.
+type sequenceSampler struct {
+	values []float64
+}
+
+func (s *sequenceSampler) Sample() (float64, error) {
+	if len(s.values) < 1 {
+		return 0, fmt.Errorf("no more values")
+	}
+	var v = s.values[0]
+	s.values = s.values[1:]
+	return v, nil
+}
+
 func TestCPU(t *testing.T) {
-	t.Skip("test is too flaky to run. ticket in the backlog")
 	var points = 3
-	var w = rolling.NewPointWindow(points)
-	var a = rolling.NewAverageRollup(w, "")
-	var c = &avgCPU{pollingInterval: time.Second, feeder: w, rollup: a}
+	var sampler = &sequenceSampler{values: []float64{90, 10, 20, 30}}
+	var tickers = &fakeTickers{}
+	var l = New(SampledCPU(50, 80, time.Second, points, sampler), PollingTicker(tickers.NewTicker))
 
-	for x := 0; x < points+1; x = x + 1 {
-		c.feed()
+	for x := 0; x < points; x = x + 1 {
+		tickers.tickers[0].tick()
 	}
-	var result = c.Aggregate().Value
-	if result <= 0 || result > 100 {
+	l.Close()
+	var result = l.aggregators[0].Aggregate().Source.Value
+	if result != 20 {
 		t.Fatalf("invalid AvgCPU percentage: %f", result)
 	}
 }
 
 func TestCPUPolling(t *testing.T) {
-	t.Skip("test is too flaky to run. ticket in the backlog")
-	var c = newAvgCPU(time.Millisecond, 5)
-	c.feed()
-	var baseline = c.Aggregate().Value
-	var stop = make(chan bool)
-	go func(stop chan bool) {
-		for {
-			select {
-			case <-stop:
-				return
-			default:
-				// Run some CPU bound operations to generate data
-				for x := 0; x < 100; x = x + 1 {
-					math.Pow(10, 1000)
-				}
-			}
-		}
-	}(stop)
-	time.Sleep(3 * time.Second)
-	var result = c.Aggregate().Value
-	close(stop)
-	if result <= baseline {
-		t.Fatalf("AvgCPU never increased: %f - %f", baseline, result)
+	var sampler = &sequenceSampler{values: []float64{10, 20, 30, 40, 50, 60}}
+	var tickers = &fakeTickers{}
+	var l = New(SampledCPU(50, 80, time.Second, 5, sampler), PollingTicker(tickers.NewTicker))
+	if len(tickers.tickers) != 1 || tickers.tickers[0].interval != time.Second {
+		t.Fatal("polling ticker was not used")
+	}
+	for x := 0; x < 4; x = x + 1 {
+		tickers.tickers[0].tick()
+	}
+	l.Close()
+	if !tickers.tickers[0].stopped {
+		t.Fatal("ticker was not stopped")
+	}
+	var result = l.aggregators[0].Aggregate().Source.Value
+	if result != 30 {
+		t.Fatalf("wrong AvgCPU after polling: %f", result)
+	}
+}
+
+func TestHostCPUSampler(t *testing.T) {
+	var times = []pscpu.TimesStat{
+		{User: 10, System: 10, Idle: 80},
+		{User: 40, System: 20, Idle: 100, Iowait: 20},
+		{User: 40, System: 20, Idle: 100, Iowait: 20},
+	}
+	var s = &hostCPUSampler{times: func() ([]pscpu.TimesStat, error) {
+		var v = times[:1]
+		times = times[1:]
+		return v, nil
+	}}
+	if _, e := s.Sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline got %v", e)
+	}
+	var v, e = s.Sample()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != 50 {
+		t.Fatalf("wrong cpu percentage %f", v)
+	}
+	if _, e = s.Sample(); e == nil {
+		t.Fatal("expected error when cpu times do not advance")
+	}
+	s.times = func() ([]pscpu.TimesStat, error) { return nil, nil }
+	if _, e = s.Sample(); e == nil {
+		t.Fatal("expected error for empty cpu times")
+	}
+	s.times = func() ([]pscpu.TimesStat, error) { return nil, fmt.Errorf("") }
+	if _, e = s.Sample(); e == nil {
+		t.Fatal("expected error from cpu times")
+	}
+}
+
+func TestHostCPUSamplerLive(t *testing.T) {
+	var s = newHostCPUSampler()
+	if _, e := s.Sample(); e != errNoBaseline {
+		t.Skipf("cpu times not available on this platform: %v", e)
+	}
+	time.Sleep(50 * time.Millisecond)
+	var v, e = s.Sample()
+	if e != nil {
+		t.Skipf("cpu times did not advance: %s", e)
+	}
+	if v < 0 || v > 100 {
+		t.Fatalf("invalid cpu percentage %f", v)
 	}
 }
@@ -0,0 +1,94 @@
+package loadshed
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// DBStatser is a source of connection pool statistics such as *sql.DB.
+type DBStatser interface {
+	Stats() sql.DBStats
+}
+
+// dbPoolSample generates a sample function that reports the connections in
+// use as a percentage of the maximum number of open connections. A pool
+// without a maximum is never saturated and always reports zero.
+func dbPoolSample(db DBStatser) func() (float64, error) {
+	return func() (float64, error) {
+		var stats = db.Stats()
+		if stats.MaxOpenConnections < 1 {
+			return 0, nil
+		}
+		return float64(stats.InUse) / float64(stats.MaxOpenConnections) * 100, nil
+	}
+}
+
+// dbWaitSampler reports how long callers waited for a connection since the
+// previous sample.
+type dbWaitSampler struct {
+	db       DBStatser
+	now      func() time.Time
+	last     sql.DBStats
+	lastTime time.Time
+}
+
+// sample returns the seconds spent waiting for a connection per second and
+// the number of waits per second.
+func (s *dbWaitSampler) sample() (float64, float64, error) {
+	var now = s.now()
+	var stats = s.db.Stats()
+	var last, lastTime = s.last, s.lastTime
+	s.last, s.lastTime = stats, now
+	var elapsed = now.Sub(lastTime).Seconds()
+	if lastTime.IsZero() || elapsed <= 0 || stats.WaitCount < last.WaitCount || stats.WaitDuration < last.WaitDuration {
+		return 0, 0, errNoBaseline
+	}
+	var duration = (stats.WaitDuration - last.WaitDuration).Seconds() / elapsed
+	var count = float64(stats.WaitCount-last.WaitCount) / elapsed
+	return duration, count, nil
+}
+
+// dbPoolWait is a rolling average Aggregator for the seconds per second that
+// callers spent waiting for a database connection, which is the average
+// number of callers waiting. The rolling average of waits per second is
+// reported as the source of the aggregate.
+type dbPoolWait struct {
+	duration *polledAverage
+	count    rolling.Rollup
+}
+
+// Name emits the rollup name for identification.
+func (d *dbPoolWait) Name() string {
+	return d.duration.Name()
+}
+
+// Aggregate emits the current rolling average of connection wait time.
+func (d *dbPoolWait) Aggregate() *rolling.Aggregate {
+	var a = d.duration.Aggregate()
+	a.Source = d.count.Aggregate()
+	return a
+}
+
+// newDBPool tracks a rolling average of connection pool usage. The time
+// window is defined as windowSize * pollingInterval.
+func newDBPool(db DBStatser, pollingInterval time.Duration, windowSize int) *polledAverage {
+	return newPolledAverage("AverageDBPool", pollingInterval, windowSize, dbPoolSample(db))
+}
+
+// newDBPoolWait tracks a rolling average of connection wait time reported by
+// the sampler. The time window is defined as windowSize * pollingInterval.
+// The poller must be started separately.
+func newDBPoolWait(sampler *dbWaitSampler, pollingInterval time.Duration, windowSize int) *dbPoolWait {
+	var w = rolling.NewPointWindow(windowSize)
+	var duration = newPolledAverage("AverageDBPoolWait", pollingInterval, windowSize, func() (float64, error) {
+		var d, c, e = sampler.sample()
+		if e != nil {
+			return 0, e
+		}
+		w.Feed(c)
+		return d, nil
+	})
+	return &dbPoolWait{duration: duration, count: rolling.NewAverageRollup(w, "AverageDBPoolWaitCount")}
+}
@@ -0,0 +1,162 @@
+package loadshed
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a database driver whose connections do nothing. It exists so
+// that the pool statistics of a real *sql.DB can be tested.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+// registerFakeDriver guards the driver registration because sql.Register
+// panics when a name is registered twice.
+var registerFakeDriver sync.Once
+
+func openFakeDB(t *testing.T, maxOpen int) *sql.DB {
+	registerFakeDriver.Do(func() {
+		sql.Register("loadshedfake", fakeDriver{})
+	})
+	var db, e = sql.Open("loadshedfake", "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	db.SetMaxOpenConns(maxOpen)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+type fakeDBStats struct {
+	stats sql.DBStats
+}
+
+func (f *fakeDBStats) Stats() sql.DBStats {
+	return f.stats
+}
+
+func TestDBPool(t *testing.T) {
+	var db = openFakeDB(t, 4)
+	for x := 0; x < 2; x = x + 1 {
+		var conn, e = db.Conn(context.Background())
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer conn.Close()
+	}
+	var p = newDBPool(db, time.Second, 1)
+	p.feed()
+	if p.Aggregate().Value != 50 {
+		t.Fatalf("wrong pool usage %f", p.Aggregate().Value)
+	}
+}
+
+func TestDBPoolUnlimited(t *testing.T) {
+	var v, e = dbPoolSample(&fakeDBStats{stats: sql.DBStats{InUse: 100}})()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != 0 {
+		t.Fatalf("unlimited pool reported usage %f", v)
+	}
+}
+
+func TestDBPoolWait(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var db = &fakeDBStats{}
+	var d = newDBPoolWait(&dbWaitSampler{db: db, now: clock.Now}, time.Second, 1)
+	d.duration.feed()
+	if d.Aggregate().Value != 0 {
+		t.Fatalf("baseline was recorded: %f", d.Aggregate().Value)
+	}
+	clock.Advance(2 * time.Second)
+	db.stats.WaitCount = 10
+	db.stats.WaitDuration = 3 * time.Second
+	d.duration.feed()
+	var a = d.Aggregate()
+	if a.Value != 1.5 {
+		t.Fatalf("wrong wait seconds per second %f", a.Value)
+	}
+	if a.Source.Value != 5 {
+		t.Fatalf("wrong waits per second %f", a.Source.Value)
+	}
+	if d.Name() != "AverageDBPoolWait" {
+		t.Fatalf("wrong name %s", d.Name())
+	}
+}
+
+func TestDBPoolWaitReset(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var db = &fakeDBStats{stats: sql.DBStats{WaitCount: 10}}
+	var s = &dbWaitSampler{db: db, now: clock.Now}
+	_, _, _ = s.sample()
+	if _, _, e := s.sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline when time did not advance got %v", e)
+	}
+	clock.Advance(time.Second)
+	db.stats.WaitCount = 1
+	if _, _, e := s.sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline after reset got %v", e)
+	}
+}
+
+func TestDBPoolWaitLive(t *testing.T) {
+	var db = openFakeDB(t, 1)
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = &dbWaitSampler{db: db, now: clock.Now}
+	_, _, _ = s.sample()
+
+	var conn, e = db.Conn(context.Background())
+	if e != nil {
+		t.Fatal(e)
+	}
+	var done = make(chan error)
+	go func() {
+		var waiting, werr = db.Conn(context.Background())
+		if werr == nil {
+			werr = waiting.Close()
+		}
+		done <- werr
+	}()
+	for db.Stats().WaitCount < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	_ = conn.Close()
+	if e = <-done; e != nil {
+		t.Fatal(e)
+	}
+
+	clock.Advance(time.Second)
+	var duration, count, serr = s.sample()
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if count != 1 {
+		t.Fatalf("wrong waits per second %f", count)
+	}
+	if duration <= 0 {
+		t.Fatalf("wait duration not recorded: %f", duration)
+	}
+}
@@ -58,15 +58,13 @@ type errorRateDecorator struct {
 	reqFeeder rolling.Feeder
 }
 
-func (h *errorRateDecorator) Wrap(next func() error) func() error {
-	return func() error {
-		var e = next()
-		h.reqFeeder.Feed(1)
+func (h *errorRateDecorator) Track(cost int) func(error) {
+	return func(e error) {
+		h.reqFeeder.Feed(float64(cost))
 
 		if e != nil {
-			h.errFeeder.Feed(1)
+			h.errFeeder.Feed(float64(cost))
 		}
-		return e
 	}
 }
 
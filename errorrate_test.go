@@ -16,10 +16,10 @@ func TestErrorRateNoError(t *testing.T) {
 	var errWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
 	var reqWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
 	var decorator = newErrorRateDecorator(errWindow, reqWindow)
-	var wrap = decorator.Wrap(func() error {
+	var wrapped = wrap(decorator, 1, func() error {
 		return nil
 	})
-	var e = wrap()
+	var e = wrapped()
 	if e != nil {
 		t.Fatal("Unexpected error")
 	}
@@ -43,10 +43,10 @@ func TestErrorRateError(t *testing.T) {
 	var errWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
 	var reqWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
 	var decorator = newErrorRateDecorator(errWindow, reqWindow)
-	var wrap = decorator.Wrap(func() error {
+	var wrapped = wrap(decorator, 1, func() error {
 		return fmt.Errorf("")
 	})
-	var e = wrap()
+	var e = wrapped()
 	if e == nil {
 		t.Fatal("Expected error")
 	}
@@ -70,11 +70,11 @@ func TestErrorRateErrorTimeBucket(t *testing.T) {
 	var errWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
 	var reqWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
 	var decorator = newErrorRateDecorator(errWindow, reqWindow)
-	var wrap = decorator.Wrap(func() error {
+	var wrapped = wrap(decorator, 1, func() error {
 		time.Sleep(time.Duration(timeWindow+1) * bucketSize)
 		return fmt.Errorf("")
 	})
-	var e = wrap()
+	var e = wrapped()
 	if e == nil {
 		t.Fatal("Expected error")
 	}
@@ -125,3 +125,30 @@ func TestErrRateRollUp(t *testing.T) {
 		t.Fatalf("Expected name %s but got %s", name, rollup.Name())
 	}
 }
+
+func TestErrorRateErrorWeighted(t *testing.T) {
+	var bucketSize = time.Millisecond
+	var timeWindow = 5
+	var preallocHint = 5
+
+	var errWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
+	var reqWindow = rolling.NewTimeWindow(bucketSize, timeWindow, preallocHint)
+	var decorator = newErrorRateDecorator(errWindow, reqWindow)
+	var weighted = wrap(decorator, 3, func() error {
+		return fmt.Errorf("")
+	})
+	var e = weighted()
+	if e == nil {
+		t.Fatal("Expected error")
+	}
+	var a = rolling.NewSumRollup(errWindow, "")
+	var eresult = a.Aggregate().Value
+	if int(eresult) != 3 {
+		t.Fatalf("Unexpected result %f", eresult)
+	}
+	var b = rolling.NewSumRollup(reqWindow, "")
+	var result = b.Aggregate().Value
+	if int(result) != 3 {
+		t.Fatalf("Unexpected result %f", result)
+	}
+}
@@ -1,6 +1,7 @@
 package loadshed
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/asecurityteam/rolling"
@@ -20,3 +21,20 @@ func (r Rejected) Error() string {
 	}
 	return reason
 }
+
+// ErrPanicked is recorded as the error of a call whose action panicked. The
+// panic is resumed once the call is recorded.
+var ErrPanicked = errors.New("loadshed: action panicked")
+
+// ErrTokenReleased is reported to the TokenHook when a Token is released more
+// than once.
+var ErrTokenReleased = errors.New("loadshed: token released more than once")
+
+// ErrTokenLeaked is reported to the TokenHook when a Token is garbage
+// collected without being released. The Token is released with this error.
+var ErrTokenLeaked = errors.New("loadshed: token garbage collected without being released")
+
+// ErrStaleSamples is reported to the PollingErrorHook when an option that
+// polls for samples has not recorded a successful sample within the number of
+// polling intervals given to PollingFallback.
+var ErrStaleSamples = errors.New("loadshed: no successful sample within the staleness limit")
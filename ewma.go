@@ -0,0 +1,123 @@
+package loadshed
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// ewma is an Aggregator for an exponentially weighted moving average in which
+// the weight of each value halves every halfLife. Values are decayed by the
+// time elapsed rather than the number of values recorded so the average
+// reacts at the same speed regardless of the rate of calls, and only a sum
+// and a weight are stored regardless of that rate. The total decayed weight
+// is reported as the source of the aggregate and the average is reported as
+// zero until the decayed number of recorded values reaches minCount,
+// regardless of their weight.
+type ewma struct {
+	name     string
+	halfLife time.Duration
+	minCount float64
+	now      func() time.Time
+
+	lock   sync.Mutex
+	sum    float64
+	weight float64
+	count  float64
+	last   time.Time
+}
+
+// decay ages the sum and weight to the given time. A halfLife of zero or less
+// discards all previous values.
+func (a *ewma) decay(now time.Time) {
+	var elapsed = now.Sub(a.last)
+	a.last = now
+	if elapsed <= 0 {
+		return
+	}
+	var factor = 0.0
+	if a.halfLife > 0 {
+		factor = math.Exp2(-float64(elapsed) / float64(a.halfLife))
+	}
+	a.sum = a.sum * factor
+	a.weight = a.weight * factor
+	a.count = a.count * factor
+}
+
+// add records a value with the given weight.
+func (a *ewma) add(value float64, weight float64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.decay(a.now())
+	a.sum = a.sum + value*weight
+	a.weight = a.weight + weight
+	a.count = a.count + 1
+}
+
+// Name emits the aggregate name for identification.
+func (a *ewma) Name() string {
+	return a.name
+}
+
+// Aggregate emits the current weighted average.
+func (a *ewma) Aggregate() *rolling.Aggregate {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.decay(a.now())
+	var value = 0.0
+	if a.weight > 0 && a.count >= a.minCount {
+		value = a.sum / a.weight
+	}
+	return &rolling.Aggregate{
+		Source: &rolling.Aggregate{Name: a.name + "Weight", Value: a.weight},
+		Name:   a.name,
+		Value:  value,
+	}
+}
+
+func newEWMA(name string, halfLife time.Duration, minCount int) *ewma {
+	var now = time.Now()
+	return &ewma{name: name, halfLife: halfLife, minCount: float64(minCount), now: time.Now, last: now}
+}
+
+type ewmaLatencyDecorator struct {
+	average *ewma
+}
+
+// Track records the latency of the action as measured, regardless of its
+// cost, with a weight of one.
+func (h *ewmaLatencyDecorator) Track(cost int) func(error) {
+	var start = h.average.now()
+	return func(error) {
+		h.average.add(h.average.now().Sub(start).Seconds(), 1)
+	}
+}
+
+// newEWMALatencyDecorator tracks latencies of an action in the given average.
+func newEWMALatencyDecorator(average *ewma) wrapper {
+	return &ewmaLatencyDecorator{average: average}
+}
+
+type ewmaErrorRateDecorator struct {
+	average *ewma
+}
+
+// Track records a failed action as 100 and a successful one as 0, weighted by
+// the cost, so that the average is the percentage of failed calls.
+func (h *ewmaErrorRateDecorator) Track(cost int) func(error) {
+	return func(e error) {
+		var value = 0.0
+		if e != nil {
+			value = 100
+		}
+		h.average.add(value, float64(cost))
+	}
+}
+
+// newEWMAErrorRateDecorator tracks the error rate of an action in the given
+// average.
+func newEWMAErrorRateDecorator(average *ewma) wrapper {
+	return &ewmaErrorRateDecorator{average: average}
+}
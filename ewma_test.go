@@ -0,0 +1,123 @@
+package loadshed
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestEWMA(halfLife time.Duration, minWeight int) (*ewma, *fakeClock) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var a = newEWMA("test", halfLife, minWeight)
+	a.now = clock.Now
+	a.last = clock.Now()
+	return a, clock
+}
+
+func TestEWMA(t *testing.T) {
+	var a, clock = newTestEWMA(time.Second, 0)
+	if a.Aggregate().Value != 0 {
+		t.Fatalf("empty average is %f", a.Aggregate().Value)
+	}
+	a.add(10, 1)
+	a.add(20, 1)
+	if a.Aggregate().Value != 15 {
+		t.Fatalf("wrong average %f", a.Aggregate().Value)
+	}
+	clock.Advance(time.Second)
+	if v := a.Aggregate().Value; v != 15 {
+		t.Fatalf("decay changed the average %f", v)
+	}
+	if w := a.Aggregate().Source.Value; w != 1 {
+		t.Fatalf("weight did not halve %f", w)
+	}
+	a.add(30, 1)
+	if v := a.Aggregate().Value; v != 22.5 {
+		t.Fatalf("wrong average after decay %f", v)
+	}
+	a.add(40, 2)
+	if v := a.Aggregate().Value; v != 31.25 {
+		t.Fatalf("wrong weighted average %f", v)
+	}
+}
+
+func TestEWMAMinCount(t *testing.T) {
+	var a, clock = newTestEWMA(time.Second, 2)
+	a.add(10, 3)
+	if a.Aggregate().Value != 0 {
+		t.Fatal("average reported before reaching the minimum count")
+	}
+	a.add(10, 1)
+	if a.Aggregate().Value != 10 {
+		t.Fatalf("wrong average %f", a.Aggregate().Value)
+	}
+	clock.Advance(time.Second)
+	if a.Aggregate().Value != 0 {
+		t.Fatal("average reported after decaying below the minimum count")
+	}
+}
+
+func TestEWMAZeroHalfLife(t *testing.T) {
+	var a, clock = newTestEWMA(0, 0)
+	a.add(10, 1)
+	clock.Advance(time.Millisecond)
+	a.add(20, 1)
+	if a.Aggregate().Value != 20 {
+		t.Fatalf("previous values were kept %f", a.Aggregate().Value)
+	}
+}
+
+func TestEWMALatencyDecorator(t *testing.T) {
+	var a, clock = newTestEWMA(time.Hour, 0)
+	var weighted = wrap(newEWMALatencyDecorator(a), 5, func() error {
+		clock.Advance(10 * time.Millisecond)
+		return nil
+	})
+	if e := weighted(); e != nil {
+		t.Fatal("Unexpected error")
+	}
+	var result = a.Aggregate()
+	if result.Value != (10 * time.Millisecond).Seconds() {
+		t.Fatalf("incorrect latency record: %f", result.Value)
+	}
+	if result.Source.Value != 1 {
+		t.Fatalf("latency weighted by cost: %f", result.Source.Value)
+	}
+}
+
+func TestEWMALatencyOption(t *testing.T) {
+	var l = New(EWMALatency(.001, .002, time.Hour, 1))
+	for x := 0; x < 2; x = x + 1 {
+		if e := l.Do(func() error { time.Sleep(5 * time.Millisecond); return nil }); e != nil {
+			t.Fatalf("Unexpected error %s", e)
+		}
+	}
+	var e = l.Do(func() error { return nil })
+	if r, ok := e.(Rejected); !ok || r.Aggregate.Name != "ChanceEWMALatency" {
+		t.Fatalf("expected rejection from latency got %v", e)
+	}
+}
+
+func TestEWMAErrorRateOption(t *testing.T) {
+	var l = New(EWMAErrorRate(10, 50, time.Hour, 2))
+	_ = l.DoWeighted(5, func() error { return fmt.Errorf("") })
+	if e := l.Do(func() error { return nil }); e != nil {
+		t.Fatalf("rejected before reaching the required calls: %s", e)
+	}
+	_ = l.Do(func() error { return fmt.Errorf("") })
+	var e = l.Do(func() error { return nil })
+	if r, ok := e.(Rejected); !ok || r.Aggregate.Name != "ChanceEWMAErrorRate" {
+		t.Fatalf("expected rejection from error rate got %v", e)
+	}
+}
+
+func TestEWMAErrorRateDecorator(t *testing.T) {
+	var a = newEWMA("EWMAErrorRate", time.Hour, 0)
+	var decorator = newEWMAErrorRateDecorator(a)
+	_ = wrap(decorator, 3, func() error { return nil })()
+	_ = wrap(decorator, 1, func() error { return fmt.Errorf("") })()
+	if v := a.Aggregate().Value; math.Abs(v-25) > .01 {
+		t.Fatalf("wrong error rate %f", v)
+	}
+}
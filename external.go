@@ -0,0 +1,296 @@
+package loadshed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// externalBodyLimit is the largest response, in bytes, read from an
+// ExternalSource.
+const externalBodyLimit = 1 << 20
+
+// ExternalSource reads the content of a metric that is produced outside of
+// the process. Sources are created with FileSource and HTTPSource.
+type ExternalSource struct {
+	read func(ctx context.Context) ([]byte, error)
+}
+
+// FileSource reads a metric from the file at path, such as one written by a
+// sidecar. If maxAge is greater than zero then a file that has not been
+// modified within maxAge is treated as a failed sample. A read that does not
+// finish before the timeout of the option, such as from a hung network file
+// system or a named pipe without a writer, is treated as a failed sample.
+func FileSource(path string, maxAge time.Duration) ExternalSource {
+	return ExternalSource{read: func(ctx context.Context) ([]byte, error) {
+		return readWithContext(ctx, func() ([]byte, error) {
+			return readExternalFile(path, maxAge)
+		})
+	}}
+}
+
+// readWithContext runs a read that cannot be cancelled in the background and
+// returns early with the error of the context once it is done. The
+// abandoned read finishes in the background and its result is discarded.
+func readWithContext(ctx context.Context, read func() ([]byte, error)) ([]byte, error) {
+	type result struct {
+		content []byte
+		e       error
+	}
+	var results = make(chan result, 1)
+	go func() {
+		var content, e = read()
+		results <- result{content: content, e: e}
+	}()
+	select {
+	case r := <-results:
+		return r.content, r.e
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// readExternalFile reads the file at path unless it has not been modified
+// within maxAge.
+func readExternalFile(path string, maxAge time.Duration) ([]byte, error) {
+	var f, e = os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	if maxAge > 0 {
+		var info, serr = f.Stat()
+		if serr != nil {
+			return nil, serr
+		}
+		if age := time.Since(info.ModTime()); age > maxAge {
+			return nil, fmt.Errorf("%s was last modified %s ago", path, age)
+		}
+	}
+	return io.ReadAll(io.LimitReader(f, externalBodyLimit))
+}
+
+// HTTPSource reads a metric from a GET request to the url, such as the
+// metrics endpoint of a local agent. Responses other than 200 OK are treated
+// as failed samples.
+func HTTPSource(url string) ExternalSource {
+	return ExternalSource{read: func(ctx context.Context) ([]byte, error) {
+		var req, e = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if e != nil {
+			return nil, e
+		}
+		var resp, rerr = http.DefaultClient.Do(req)
+		if rerr != nil {
+			return nil, rerr
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, externalBodyLimit))
+	}}
+}
+
+// ExternalParser extracts a value from the content of an ExternalSource.
+// Parsers are created with ParseNumber, ParseJSON, and ParsePrometheus.
+type ExternalParser struct {
+	parse func(content []byte) (float64, error)
+}
+
+// ParseNumber parses content that is a single number, such as "42\n".
+func ParseNumber() ExternalParser {
+	return ExternalParser{parse: func(content []byte) (float64, error) {
+		return parseExternalFloat(strings.TrimSpace(string(content)))
+	}}
+}
+
+// ParseJSON parses a number from a JSON document. The path is a dot separated
+// list of object keys and array indexes, such as "queues.0.depth".
+func ParseJSON(path string) ExternalParser {
+	var keys = strings.Split(path, ".")
+	return ExternalParser{parse: func(content []byte) (float64, error) {
+		var doc interface{}
+		if e := json.Unmarshal(content, &doc); e != nil {
+			return 0, e
+		}
+		for _, key := range keys {
+			switch node := doc.(type) {
+			case map[string]interface{}:
+				var next, ok = node[key]
+				if !ok {
+					return 0, fmt.Errorf("json path %s not found at %s", path, key)
+				}
+				doc = next
+			case []interface{}:
+				var index, e = strconv.Atoi(key)
+				if e != nil || index < 0 || index >= len(node) {
+					return 0, fmt.Errorf("json path %s has invalid index %s", path, key)
+				}
+				doc = node[index]
+			default:
+				return 0, fmt.Errorf("json path %s not found at %s", path, key)
+			}
+		}
+		var value, ok = doc.(float64)
+		if !ok {
+			return 0, fmt.Errorf("json path %s is not a number", path)
+		}
+		return value, nil
+	}}
+}
+
+// ParsePrometheus parses a sample from the Prometheus text exposition format.
+// The sample must have the given metric name and include all of the given
+// labels. Exactly one sample must match.
+func ParsePrometheus(name string, labels map[string]string) ExternalParser {
+	return ExternalParser{parse: func(content []byte) (float64, error) {
+		var found = false
+		var result float64
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			var sampleName, sampleLabels, value, e = parsePrometheusLine(line)
+			if e != nil {
+				return 0, e
+			}
+			if sampleName != name || !prometheusLabelsMatch(sampleLabels, labels) {
+				continue
+			}
+			if found {
+				return 0, fmt.Errorf("more than one sample of %s matches %v", name, labels)
+			}
+			var v, perr = parseExternalFloat(value)
+			if perr != nil {
+				return 0, perr
+			}
+			found = true
+			result = v
+		}
+		if !found {
+			return 0, fmt.Errorf("no sample of %s matches %v", name, labels)
+		}
+		return result, nil
+	}}
+}
+
+// parsePrometheusLine splits a sample line such as
+// `queue_depth{queue="high"} 12 1700000000000` into its metric name, labels,
+// and value. The optional timestamp is ignored.
+func parsePrometheusLine(line string) (string, map[string]string, string, error) {
+	var end = strings.IndexAny(line, "{ \t")
+	if end < 1 {
+		return "", nil, "", fmt.Errorf("invalid prometheus sample %q", line)
+	}
+	var name = line[:end]
+	var rest = line[end:]
+	var labels = map[string]string{}
+	if strings.HasPrefix(rest, "{") {
+		var consumed, e = parsePrometheusLabels(rest[1:], labels)
+		if e != nil {
+			return "", nil, "", fmt.Errorf("invalid prometheus sample %q: %s", line, e)
+		}
+		rest = rest[1+consumed:]
+	}
+	var fields = strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return "", nil, "", fmt.Errorf("invalid prometheus sample %q", line)
+	}
+	return name, labels, fields[0], nil
+}
+
+// parsePrometheusLabels parses a label set, starting after the opening brace,
+// into labels and returns the number of bytes consumed including the closing
+// brace.
+func parsePrometheusLabels(s string, labels map[string]string) (int, error) {
+	var x = 0
+	for {
+		for x < len(s) && (s[x] == ' ' || s[x] == ',') {
+			x = x + 1
+		}
+		if x >= len(s) {
+			return 0, fmt.Errorf("unterminated labels")
+		}
+		if s[x] == '}' {
+			return x + 1, nil
+		}
+		var eq = strings.IndexByte(s[x:], '=')
+		if eq < 1 || x+eq+1 >= len(s) || s[x+eq+1] != '"' {
+			return 0, fmt.Errorf("invalid label at %q", s[x:])
+		}
+		var key = strings.TrimSpace(s[x : x+eq])
+		x = x + eq + 2
+		var value strings.Builder
+		for {
+			if x >= len(s) {
+				return 0, fmt.Errorf("unterminated label value for %s", key)
+			}
+			var c = s[x]
+			x = x + 1
+			if c == '"' {
+				break
+			}
+			if c == '\\' && x < len(s) {
+				c = s[x]
+				x = x + 1
+				if c == 'n' {
+					c = '\n'
+				}
+			}
+			value.WriteByte(c)
+		}
+		labels[key] = value.String()
+	}
+}
+
+func prometheusLabelsMatch(sample map[string]string, want map[string]string) bool {
+	for k, v := range want {
+		if sample[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func parseExternalFloat(s string) (float64, error) {
+	var v, e = strconv.ParseFloat(s, 64)
+	if e != nil {
+		return 0, e
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid value %s", s)
+	}
+	return v, nil
+}
+
+// externalSample generates a sample function that reads and parses an
+// external metric. Reads that take longer than timeout are cancelled.
+func externalSample(source ExternalSource, parser ExternalParser, timeout time.Duration) func() (float64, error) {
+	return func() (float64, error) {
+		var ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var content, e = source.read(ctx)
+		if e != nil {
+			return 0, e
+		}
+		return parser.parse(content)
+	}
+}
+
+// newExternal tracks a rolling average of an external metric. The time
+// window is defined as windowSize * pollingInterval. A timeout of zero or
+// less defaults to the pollingInterval.
+func newExternal(name string, source ExternalSource, parser ExternalParser, pollingInterval time.Duration, windowSize int, timeout time.Duration) *polledAverage {
+	if timeout <= 0 {
+		timeout = pollingInterval
+	}
+	return newPolledAverage("Average"+name, pollingInterval, windowSize, externalSample(source, parser, timeout))
+}
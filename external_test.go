@@ -0,0 +1,176 @@
+package loadshed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var prometheusFixture = `# HELP queue_depth Items waiting in the queue.
+# TYPE queue_depth gauge
+queue_depth{queue="high",region="us"} 12
+queue_depth{queue="low",region="us"} 40 1700000000000
+queue_depth{queue="odd \"name\"",region="us"} 3
+queue_latency_seconds 0.25
+`
+
+func TestParseNumber(t *testing.T) {
+	var v, e = ParseNumber().parse([]byte(" 42.5\n"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != 42.5 {
+		t.Fatalf("wrong value %f", v)
+	}
+	for _, content := range []string{"", "abc", "NaN", "+Inf"} {
+		if _, e = ParseNumber().parse([]byte(content)); e == nil {
+			t.Fatalf("%q: expected error", content)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	var content = []byte(`{"queues": [{"depth": 7}, {"depth": 9, "name": "low"}], "total": 16}`)
+	var tc = []struct {
+		path     string
+		expected float64
+	}{
+		{"total", 16},
+		{"queues.0.depth", 7},
+		{"queues.1.depth", 9},
+	}
+	for _, c := range tc {
+		var v, e = ParseJSON(c.path).parse(content)
+		if e != nil {
+			t.Fatalf("%s: %s", c.path, e)
+		}
+		if v != c.expected {
+			t.Fatalf("%s: expected %f got %f", c.path, c.expected, v)
+		}
+	}
+	for _, path := range []string{"missing", "queues.2.depth", "queues.x.depth", "queues.1.name", "total.depth"} {
+		if _, e := ParseJSON(path).parse(content); e == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+	}
+	if _, e := ParseJSON("total").parse([]byte(`{`)); e == nil {
+		t.Fatal("expected error for invalid json")
+	}
+}
+
+func TestParsePrometheus(t *testing.T) {
+	var tc = []struct {
+		name     string
+		labels   map[string]string
+		expected float64
+	}{
+		{"queue_depth", map[string]string{"queue": "high"}, 12},
+		{"queue_depth", map[string]string{"queue": "low", "region": "us"}, 40},
+		{"queue_depth", map[string]string{"queue": `odd "name"`}, 3},
+		{"queue_latency_seconds", nil, .25},
+	}
+	for _, c := range tc {
+		var v, e = ParsePrometheus(c.name, c.labels).parse([]byte(prometheusFixture))
+		if e != nil {
+			t.Fatalf("%s%v: %s", c.name, c.labels, e)
+		}
+		if v != c.expected {
+			t.Fatalf("%s%v: expected %f got %f", c.name, c.labels, c.expected, v)
+		}
+	}
+	if _, e := ParsePrometheus("queue_depth", nil).parse([]byte(prometheusFixture)); e == nil {
+		t.Fatal("expected error for ambiguous sample")
+	}
+	if _, e := ParsePrometheus("queue_depth", map[string]string{"queue": "none"}).parse([]byte(prometheusFixture)); e == nil {
+		t.Fatal("expected error for missing sample")
+	}
+	for _, content := range []string{`queue_depth{queue="high" 1`, `queue_depth{queue=high} 1`, `queue_depth`, `queue_depth 1 2 3`, `queue_depth abc`} {
+		if _, e := ParsePrometheus("queue_depth", nil).parse([]byte(content)); e == nil {
+			t.Fatalf("%q: expected error", content)
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "queue", "5\n")
+	var path = filepath.Join(root, "queue")
+	var p = newExternal("Queue", FileSource(path, time.Hour), ParseNumber(), time.Second, 1, 0)
+	p.feed()
+	if p.Aggregate().Value != 5 {
+		t.Fatalf("wrong external value %f", p.Aggregate().Value)
+	}
+	if p.Name() != "AverageQueue" {
+		t.Fatalf("wrong name %s", p.Name())
+	}
+	var old = time.Now().Add(-2 * time.Hour)
+	if e := os.Chtimes(path, old, old); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := externalSample(FileSource(path, time.Hour), ParseNumber(), time.Second)(); e == nil {
+		t.Fatal("expected error for stale file")
+	}
+	if _, e := externalSample(FileSource(path, 0), ParseNumber(), time.Second)(); e != nil {
+		t.Fatalf("unexpected error without max age: %s", e)
+	}
+	if _, e := externalSample(FileSource(filepath.Join(root, "missing"), 0), ParseNumber(), time.Second)(); e == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte(prometheusFixture))
+	}))
+	defer server.Close()
+
+	var parser = ParsePrometheus("queue_depth", map[string]string{"queue": "low"})
+	var v, e = externalSample(HTTPSource(server.URL+"/metrics"), parser, time.Second)()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != 40 {
+		t.Fatalf("wrong external value %f", v)
+	}
+	if _, e = externalSample(HTTPSource(server.URL+"/error"), parser, time.Second)(); e == nil {
+		t.Fatal("expected error for failed response")
+	}
+	if _, e = externalSample(HTTPSource(server.URL+"/slow"), parser, time.Millisecond)(); e == nil {
+		t.Fatal("expected error for timeout")
+	}
+	if _, e = externalSample(HTTPSource("://invalid"), ParseNumber(), time.Second)(); e == nil {
+		t.Fatal("expected error for invalid url")
+	}
+}
+
+func TestReadWithContext(t *testing.T) {
+	var release = make(chan struct{})
+	defer close(release)
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	var _, e = readWithContext(ctx, func() ([]byte, error) {
+		<-release
+		return []byte("5"), nil
+	})
+	if !errors.Is(e, context.Canceled) {
+		t.Fatalf("expected canceled error for blocked read but got %v", e)
+	}
+	var content, re = readWithContext(context.Background(), func() ([]byte, error) {
+		return []byte("5"), nil
+	})
+	if re != nil || string(content) != "5" {
+		t.Fatalf("wrong read result %q %v", content, re)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package loadshed
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileSourceTimeout(t *testing.T) {
+	var fifo = filepath.Join(t.TempDir(), "queue")
+	if e := syscall.Mkfifo(fifo, 0o600); e != nil {
+		t.Skipf("named pipes unavailable: %s", e)
+	}
+	defer func() {
+		// Opening the pipe for writing releases the reader that is still
+		// blocked waiting for a writer.
+		if w, e := os.OpenFile(fifo, os.O_WRONLY, 0); e == nil {
+			_ = w.Close()
+		}
+	}()
+
+	var start = time.Now()
+	var _, e = externalSample(FileSource(fifo, 0), ParseNumber(), 10*time.Millisecond)()
+	if !errors.Is(e, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error for blocked read but got %v", e)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("blocked read was not timed out after %s", elapsed)
+	}
+}
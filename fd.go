@@ -0,0 +1,38 @@
+package loadshed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fdSample generates a sample function that reports the number of open file
+// descriptors of the current process, read from the proc filesystem mounted
+// at procRoot, as a percentage of the limit.
+func fdSample(procRoot string, limit func() (uint64, error)) func() (float64, error) {
+	var path = filepath.Join(procRoot, "self", "fd")
+	return func() (float64, error) {
+		var l, e = limit()
+		if e != nil {
+			return 0, e
+		}
+		if l == 0 {
+			return 0, fmt.Errorf("file descriptor limit is zero")
+		}
+		var entries, rerr = os.ReadDir(path)
+		if rerr != nil {
+			return 0, rerr
+		}
+		return float64(len(entries)) / float64(l) * 100, nil
+	}
+}
+
+// newFileDescriptors tracks a rolling average of open file descriptors as a
+// percentage of the RLIMIT_NOFILE soft limit.
+func newFileDescriptors(procRoot string, pollingInterval time.Duration, windowSize int) *polledAverage {
+	if procRoot == "" {
+		procRoot = defaultProcRoot
+	}
+	return newPolledAverage("AverageFileDescriptors", pollingInterval, windowSize, fdSample(procRoot, fdLimit))
+}
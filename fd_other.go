@@ -0,0 +1,10 @@
+//go:build !unix
+
+package loadshed
+
+import "fmt"
+
+// fdLimit is not supported on this platform.
+func fdLimit() (uint64, error) {
+	return 0, fmt.Errorf("file descriptor limit is not supported on this platform")
+}
@@ -0,0 +1,42 @@
+package loadshed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFileDescriptors(t *testing.T) {
+	var root = t.TempDir()
+	for x := 0; x < 5; x = x + 1 {
+		writeFixture(t, root, fmt.Sprintf("self/fd/%d", x), "")
+	}
+	var p = newPolledAverage("test", time.Second, 1, fdSample(root, func() (uint64, error) { return 20, nil }))
+	p.feed()
+	if p.Aggregate().Value != 25 {
+		t.Fatalf("wrong file descriptor percentage %f", p.Aggregate().Value)
+	}
+}
+
+func TestFileDescriptorsErrors(t *testing.T) {
+	var root = t.TempDir()
+	if _, e := fdSample(root, func() (uint64, error) { return 0, fmt.Errorf("") })(); e == nil {
+		t.Fatal("expected error from limit")
+	}
+	if _, e := fdSample(root, func() (uint64, error) { return 0, nil })(); e == nil {
+		t.Fatal("expected error from zero limit")
+	}
+	if _, e := fdSample(root, func() (uint64, error) { return 10, nil })(); e == nil {
+		t.Fatal("expected error from missing directory")
+	}
+}
+
+func TestFileDescriptorLimit(t *testing.T) {
+	var limit, e = fdLimit()
+	if e != nil {
+		t.Skipf("file descriptor limit not available on this platform: %s", e)
+	}
+	if limit == 0 {
+		t.Fatal("file descriptor limit is zero")
+	}
+}
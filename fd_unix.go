@@ -0,0 +1,14 @@
+//go:build unix
+
+package loadshed
+
+import "syscall"
+
+// fdLimit reads the soft limit on the number of open file descriptors.
+func fdLimit() (uint64, error) {
+	var limit syscall.Rlimit
+	if e := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); e != nil {
+		return 0, e
+	}
+	return uint64(limit.Cur), nil
+}
@@ -0,0 +1,58 @@
+package loadshed
+
+import "fmt"
+
+const (
+	gcCPUMetric    = "/cpu/classes/gc/total:cpu-seconds"
+	totalCPUMetric = "/cpu/classes/total:cpu-seconds"
+)
+
+// gcSampler computes the percentage of available CPU time spent on garbage
+// collection between consecutive calls to sample. The available CPU time is
+// GOMAXPROCS multiplied by the wall time. The runtime only updates these
+// metrics when a collection runs so a sample without any change means that
+// no time was spent on garbage collection.
+type gcSampler struct {
+	read      func(string) (runtimeSnapshot, error)
+	baseline  bool
+	lastGC    float64
+	lastTotal float64
+}
+
+func (s *gcSampler) sample() (float64, error) {
+	var gc, e = s.read(gcCPUMetric)
+	if e != nil {
+		return 0, e
+	}
+	var total, terr = s.read(totalCPUMetric)
+	if terr != nil {
+		return 0, terr
+	}
+	var baseline, lastGC, lastTotal = s.baseline, s.lastGC, s.lastTotal
+	s.baseline, s.lastGC, s.lastTotal = true, gc.value, total.value
+	// Counters that move backwards cannot be compared.
+	if !baseline || total.value < lastTotal || gc.value < lastGC {
+		return 0, errNoBaseline
+	}
+	if total.value == lastTotal {
+		return 0, nil
+	}
+	return (gc.value - lastGC) / (total.value - lastTotal) * 100, nil
+}
+
+// gcSample generates the sample function used by GCPressure. If the running
+// version of Go does not provide the CPU metrics, as reported by validate,
+// then every sample fails with an error describing the missing metric.
+func gcSample(validate func(string, Reducer) error) func() (float64, error) {
+	for _, name := range []string{gcCPUMetric, totalCPUMetric} {
+		if e := validate(name, ReduceLatest()); e != nil {
+			return failingSample(fmt.Errorf("GCPressure requires Go 1.20 or later: %w", e))
+		}
+	}
+	return newGCSampler().sample
+}
+
+// newGCSampler generates a sampler that reads from the runtime.
+func newGCSampler() *gcSampler {
+	return &gcSampler{read: readRuntimeSnapshot}
+}
@@ -0,0 +1,97 @@
+package loadshed
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+func TestGCSampler(t *testing.T) {
+	var values = map[string][]float64{
+		gcCPUMetric:    {1, 2, 5},
+		totalCPUMetric: {10, 20, 30},
+	}
+	var s = &gcSampler{read: func(name string) (runtimeSnapshot, error) {
+		var v = values[name][0]
+		values[name] = values[name][1:]
+		return runtimeSnapshot{value: v}, nil
+	}}
+	if _, e := s.sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline: %v", e)
+	}
+	replay(t, s.sample, []float64{10, 30})
+}
+
+func TestGCSamplerIdle(t *testing.T) {
+	var values = map[string][]float64{
+		gcCPUMetric:    {1, 1, 1, 2},
+		totalCPUMetric: {10, 10, 10, 20},
+	}
+	var s = &gcSampler{read: func(name string) (runtimeSnapshot, error) {
+		var v = values[name][0]
+		values[name] = values[name][1:]
+		return runtimeSnapshot{value: v}, nil
+	}}
+	if _, e := s.sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline: %v", e)
+	}
+	replay(t, s.sample, []float64{0, 0, 10})
+}
+
+func TestGCSamplerIdleFallback(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = &gcSampler{read: func(name string) (runtimeSnapshot, error) {
+		return runtimeSnapshot{value: 1}, nil
+	}}
+	var p = newPolledAverage("AverageGCCPU", time.Second, 10, s.sample)
+	p.now = clock.Now
+	p.lastSuccess = clock.Now()
+	p.staleAfter = 2
+	p.fallback = FallbackFull
+	var a = &polledAggregator{Rollup: rolling.NewPercentageRollup(p, 25, 50, "ChanceGCCPU"), poller: p.poller}
+	for x := 0; x < 5; x = x + 1 {
+		clock.Advance(time.Second)
+		p.feed()
+		if v := a.Aggregate().Value; v != 0 {
+			t.Fatalf("idle collector rejected traffic after %d polls: %f", x, v)
+		}
+	}
+}
+
+func TestGCSampleUnsupported(t *testing.T) {
+	var sample = gcSample(func(name string, r Reducer) error {
+		return fmt.Errorf("runtime metric %s is not supported", name)
+	})
+	if _, e := sample(); e == nil {
+		t.Fatal("expected error for unsupported metrics")
+	}
+	sample = gcSample(validateRuntimeMetric)
+	if _, e := sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline: %v", e)
+	}
+}
+
+func TestGCSamplerError(t *testing.T) {
+	var s = &gcSampler{read: func(name string) (runtimeSnapshot, error) {
+		return runtimeSnapshot{}, fmt.Errorf("")
+	}}
+	if _, e := s.sample(); e == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestGCSamplerRuntime(t *testing.T) {
+	var p = newPolledAverage("test", time.Millisecond, 1, newGCSampler().sample)
+	p.feed()
+	for x := 0; x < 3; x = x + 1 {
+		time.Sleep(5 * time.Millisecond)
+		runtime.GC()
+	}
+	p.feed()
+	if v := p.Aggregate().Value; v < 0 || v > 100 {
+		t.Fatalf("invalid gc percentage %f", v)
+	}
+}
@@ -1,10 +1,15 @@
 module github.com/asecurityteam/loadshed
 
-go 1.12
+go 1.19
 
 require (
 	github.com/asecurityteam/rolling v0.0.0-20171031124617-6011875bcfaf
-	github.com/go-ole/go-ole v1.2.4 // indirect
 	github.com/shirou/gopsutil v0.0.0-20190731134726-d80c43f9c984
+)
+
+require (
+	github.com/StackExchange/wmi v0.0.0-20180116203802-5d049714c4a6 // indirect
+	github.com/go-ole/go-ole v1.2.4 // indirect
+	github.com/shirou/w32 v0.0.0-20160930032740-bb4de0191aa4 // indirect
 	golang.org/x/sys v0.0.0-20190801041406-cbf593c0f2f3 // indirect
 )
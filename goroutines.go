@@ -0,0 +1,38 @@
+package loadshed
+
+import (
+	"runtime"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// goroutines is an Aggregator for the number of goroutines that currently
+// exist.
+type goroutines struct {
+	count func() int
+}
+
+// Name emits the aggregate name for identification.
+func (g *goroutines) Name() string {
+	return "Goroutines"
+}
+
+// Aggregate returns the current number of goroutines.
+func (g *goroutines) Aggregate() *rolling.Aggregate {
+	return &rolling.Aggregate{
+		Source: nil,
+		Name:   g.Name(),
+		Value:  float64(g.count()),
+	}
+}
+
+// goroutineSample reports the current number of goroutines.
+func goroutineSample() (float64, error) {
+	return float64(runtime.NumGoroutine()), nil
+}
+
+// newGoroutines generates an Aggregator that reports the number of goroutines
+// each time it is aggregated.
+func newGoroutines() *goroutines {
+	return &goroutines{count: runtime.NumGoroutine}
+}
@@ -0,0 +1,37 @@
+package loadshed
+
+import (
+	"testing"
+)
+
+func TestGoroutines(t *testing.T) {
+	var g = &goroutines{count: func() int { return 42 }}
+	var a = g.Aggregate()
+	if a.Value != 42 {
+		t.Fatalf("wrong goroutine count %f", a.Value)
+	}
+	if a.Name != g.Name() {
+		t.Fatalf("wrong name %s", a.Name)
+	}
+}
+
+func TestGoroutinesRuntime(t *testing.T) {
+	var stop = make(chan struct{})
+	defer close(stop)
+	var baseline = newGoroutines().Aggregate().Value
+	var sampleBaseline, _ = goroutineSample()
+	for x := 0; x < 10; x = x + 1 {
+		go func() { <-stop }()
+	}
+	var v = newGoroutines().Aggregate().Value
+	if v < baseline+10 {
+		t.Fatalf("goroutine count did not increase: %f - %f", baseline, v)
+	}
+	var s, e = goroutineSample()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s < sampleBaseline+10 {
+		t.Fatalf("goroutine sample did not increase: %f - %f", sampleBaseline, s)
+	}
+}
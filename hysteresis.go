@@ -0,0 +1,84 @@
+package loadshed
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// hysteresis smooths the combined rejection probability to prevent
+// oscillation. Shedding starts once the probability reaches enter and stops
+// once it falls to exit, but never before hold has elapsed since it started.
+// The effective probability does not drop until hold has elapsed since
+// shedding started. After that it follows the combined probability. In both
+// cases it changes by no more than slewRate per second.
+type hysteresis struct {
+	enter    float64
+	exit     float64
+	slewRate float64
+	hold     time.Duration
+	now      func() time.Time
+	lock     *sync.Mutex
+	shedding bool
+	started  time.Time
+	last     time.Time
+	value    float64
+}
+
+// Smooth applies hysteresis to the given aggregate and returns a copy of it
+// with the effective probability. The copy keeps the Name and Source of the
+// given aggregate so that a rejection still explains its cause.
+func (h *hysteresis) Smooth(a *rolling.Aggregate) *rolling.Aggregate {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var now = h.now()
+	var p = math.Max(0, math.Min(1, a.Value))
+	switch {
+	case !h.shedding && p >= h.enter && p > 0:
+		h.shedding = true
+		h.started = now
+	case h.shedding && p <= h.exit && now.Sub(h.started) >= h.hold:
+		h.shedding = false
+	}
+	var target = 0.0
+	switch {
+	case h.shedding && now.Sub(h.started) < h.hold:
+		target = math.Max(p, h.value)
+	case h.shedding:
+		target = p
+	}
+	h.value = h.slew(target, now)
+	h.last = now
+	var result = *a
+	result.Value = h.value
+	return &result
+}
+
+func (h *hysteresis) slew(target float64, now time.Time) float64 {
+	if h.slewRate <= 0 {
+		return target
+	}
+	var limit = 0.0
+	if !h.last.IsZero() {
+		limit = h.slewRate * now.Sub(h.last).Seconds()
+	}
+	if target > h.value {
+		return math.Min(target, h.value+limit)
+	}
+	return math.Max(target, h.value-limit)
+}
+
+// newHysteresis generates a hysteresis filter using the system clock.
+func newHysteresis(enter float64, exit float64, slewRate float64, hold time.Duration) *hysteresis {
+	return &hysteresis{
+		enter:    enter,
+		exit:     exit,
+		slewRate: slewRate,
+		hold:     hold,
+		now:      time.Now,
+		lock:     &sync.Mutex{},
+	}
+}
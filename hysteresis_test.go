@@ -0,0 +1,130 @@
+package loadshed
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+type fakeClock struct {
+	current time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.current
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.current = c.current.Add(d)
+}
+
+func smooth(h *hysteresis, value float64) float64 {
+	return h.Smooth(&rolling.Aggregate{Name: "test", Value: value}).Value
+}
+
+func TestHysteresisThresholds(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var h = newHysteresis(.5, .1, 0, 0)
+	h.now = clock.Now
+
+	if v := smooth(h, .4); v != 0 {
+		t.Fatalf("shedding started below enter threshold: %f", v)
+	}
+	if v := smooth(h, .6); v != .6 {
+		t.Fatalf("shedding did not start at enter threshold: %f", v)
+	}
+	if v := smooth(h, .3); v != .3 {
+		t.Fatalf("shedding stopped above exit threshold: %f", v)
+	}
+	if v := smooth(h, .1); v != 0 {
+		t.Fatalf("shedding did not stop at exit threshold: %f", v)
+	}
+	if v := smooth(h, .3); v != 0 {
+		t.Fatalf("shedding restarted below enter threshold: %f", v)
+	}
+}
+
+func TestHysteresisHold(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var h = newHysteresis(.5, .1, 0, time.Second)
+	h.now = clock.Now
+
+	_ = smooth(h, 1)
+	for x := 0; x < 9; x = x + 1 {
+		clock.Advance(100 * time.Millisecond)
+		if v := smooth(h, 0); v != 1 {
+			t.Fatalf("probability dropped before hold elapsed: %f", v)
+		}
+	}
+	clock.Advance(100 * time.Millisecond)
+	if v := smooth(h, 0); v != 0 {
+		t.Fatalf("shedding did not stop after hold elapsed: %f", v)
+	}
+}
+
+func TestHysteresisSlewRate(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var h = newHysteresis(.1, .1, .5, 0)
+	h.now = clock.Now
+
+	if v := smooth(h, 1); v != 0 {
+		t.Fatalf("probability jumped on first evaluation: %f", v)
+	}
+	clock.Advance(time.Second)
+	if v := smooth(h, 1); v != .5 {
+		t.Fatalf("probability exceeded slew rate: %f", v)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if v := smooth(h, 1); math.Abs(v-.55) > 1e-9 {
+		t.Fatalf("probability exceeded slew rate: %f", v)
+	}
+	clock.Advance(10 * time.Second)
+	if v := smooth(h, 1); v != 1 {
+		t.Fatalf("probability did not reach target: %f", v)
+	}
+	clock.Advance(time.Second)
+	if v := smooth(h, 0); v != .5 {
+		t.Fatalf("probability exceeded slew rate on exit: %f", v)
+	}
+}
+
+func TestHysteresisKeepsName(t *testing.T) {
+	var h = newHysteresis(.5, .1, 0, 0)
+	var source = &rolling.Aggregate{Name: "source"}
+	var result = h.Smooth(&rolling.Aggregate{Name: "test", Source: source, Value: 1})
+	if result.Name != "test" || result.Source != source {
+		t.Fatalf("smoothing lost the dominant aggregate: %s", result.Name)
+	}
+}
+
+func TestHysteresisOption(t *testing.T) {
+	var option = &fakeOption{err: true}
+	var l = New(option.Option(), Hysteresis(.5, .1, 0, time.Second))
+	var e = l.Do(func() error { return nil })
+	var r, ok = e.(Rejected)
+	if !ok {
+		t.Fatal("Did not get expected error")
+	}
+	if r.Aggregate.Name != "Zero" {
+		t.Fatalf("rejection lost the dominant aggregate: %s", r.Error())
+	}
+}
+
+func TestHysteresisDecision(t *testing.T) {
+	var option = &fakeOption{err: true}
+	var l = New(option.Option(), Hysteresis(.5, .1, 0, time.Second), Brownout(1))
+	var name string
+	var e = l.DoContext(context.Background(), func(ctx context.Context) error {
+		name = DecisionFromContext(ctx).Aggregate.Name
+		return nil
+	})
+	if e != nil {
+		t.Fatalf("Unexpected error %s", e)
+	}
+	if name != "Zero" {
+		t.Fatalf("decision lost the dominant aggregate: %s", name)
+	}
+}
@@ -8,19 +8,20 @@ import (
 
 type latencyDecorator struct {
 	feeder rolling.Feeder
+	now    func() time.Time
 }
 
-func (h *latencyDecorator) Wrap(next func() error) func() error {
-	return func() error {
-		var start = time.Now()
-		var e = next()
-		h.feeder.Feed(time.Since(start).Seconds())
-		return e
+// Track records the latency of the action. The cost does not change the
+// recorded latency so that thresholds keep their meaning for weighted calls.
+func (h *latencyDecorator) Track(cost int) func(error) {
+	var start = h.now()
+	return func(error) {
+		h.feeder.Feed(h.now().Sub(start).Seconds())
 	}
 }
 
 // newLatencyTrackingDecorator tracks latencies of an acion using a given
 // rollingdwindow.Feeder.
 func newLatencyTrackingDecorator(feeder rolling.Feeder) wrapper {
-	return &latencyDecorator{feeder}
+	return &latencyDecorator{feeder: feeder, now: time.Now}
 }
@@ -11,11 +11,11 @@ import (
 func TestLatencyDecorator(t *testing.T) {
 	var window = rolling.NewPointWindow(1)
 	var decorator = newLatencyTrackingDecorator(window)
-	var wrap = decorator.Wrap(func() error {
+	var wrapped = wrap(decorator, 1, func() error {
 		time.Sleep(5 * time.Millisecond)
 		return nil
 	})
-	var e = wrap()
+	var e = wrapped()
 	if e != nil {
 		t.Fatal("Unexpected error")
 	}
@@ -29,11 +29,11 @@ func TestLatencyDecorator(t *testing.T) {
 func TestLatencyDecoratorError(t *testing.T) {
 	var window = rolling.NewPointWindow(1)
 	var decorator = newLatencyTrackingDecorator(window)
-	var wrap = decorator.Wrap(func() error {
+	var wrapped = wrap(decorator, 1, func() error {
 		time.Sleep(5 * time.Millisecond)
 		return fmt.Errorf("")
 	})
-	var e = wrap()
+	var e = wrapped()
 	if e == nil {
 		t.Fatal("Expected error")
 	}
@@ -43,3 +43,22 @@ func TestLatencyDecoratorError(t *testing.T) {
 		t.Fatalf("incorrect latency record: %f", result)
 	}
 }
+
+func TestLatencyDecoratorWeighted(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var window = rolling.NewPointWindow(1)
+	var decorator = &latencyDecorator{feeder: window, now: clock.Now}
+	var weighted = wrap(decorator, 5, func() error {
+		clock.Advance(10 * time.Millisecond)
+		return nil
+	})
+	var e = weighted()
+	if e != nil {
+		t.Fatal("Unexpected error")
+	}
+	var a = rolling.NewSumRollup(window, "")
+	var result = a.Aggregate().Value
+	if result != (10 * time.Millisecond).Seconds() {
+		t.Fatalf("incorrect latency record: %f", result)
+	}
+}
@@ -0,0 +1,102 @@
+package loadshed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	psload "github.com/shirou/gopsutil/load"
+)
+
+// LoadPeriod selects one of the system load averages.
+type LoadPeriod int
+
+const (
+	// Load1 is the load average over 1 minute.
+	Load1 LoadPeriod = iota
+	// Load5 is the load average over 5 minutes.
+	Load5
+	// Load15 is the load average over 15 minutes.
+	Load15
+)
+
+// loadAveragePollingInterval is how often the load average is read. The
+// kernel only recalculates the averages every five seconds.
+const loadAveragePollingInterval = 5 * time.Second
+
+// defaultProcRoot is where the proc filesystem is mounted.
+const defaultProcRoot = "/proc"
+
+// loadAverageSample generates a sample function that reports the selected load
+// average divided by the number of cores.
+func loadAverageSample(source func() (*psload.AvgStat, error), which LoadPeriod, cores func() int) func() (float64, error) {
+	return func() (float64, error) {
+		var avg, e = source()
+		if e != nil {
+			return 0, e
+		}
+		var value float64
+		switch which {
+		case Load1:
+			value = avg.Load1
+		case Load5:
+			value = avg.Load5
+		case Load15:
+			value = avg.Load15
+		default:
+			return 0, fmt.Errorf("invalid load period %d", which)
+		}
+		return value / float64(cores()), nil
+	}
+}
+
+// parseRunQueue extracts the number of runnable tasks from the content of
+// /proc/loadavg, such as "0.50 0.40 0.30 3/512 12345".
+func parseRunQueue(content string) (float64, error) {
+	var fields = strings.Fields(content)
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("invalid loadavg: %q", content)
+	}
+	var parts = strings.SplitN(fields[3], "/", 2)
+	var v, e = strconv.ParseUint(parts[0], 10, 64)
+	if e != nil {
+		return 0, fmt.Errorf("invalid runnable count %q: %s", fields[3], e)
+	}
+	return float64(v), nil
+}
+
+// runQueueSample generates a sample function that reports the number of
+// runnable tasks from the loadavg file beneath procRoot divided by the number
+// of cores.
+func runQueueSample(procRoot string, cores func() int) func() (float64, error) {
+	var path = filepath.Join(procRoot, "loadavg")
+	return func() (float64, error) {
+		var b, e = os.ReadFile(path)
+		if e != nil {
+			return 0, e
+		}
+		var v, perr = parseRunQueue(string(b))
+		if perr != nil {
+			return 0, perr
+		}
+		return v / float64(cores()), nil
+	}
+}
+
+// newLoadAverage tracks the selected system load average per core.
+func newLoadAverage(which LoadPeriod) *polledAverage {
+	return newPolledAverage("LoadAverage", loadAveragePollingInterval, 1, loadAverageSample(psload.Avg, which, runtime.NumCPU))
+}
+
+// newRunQueue tracks a rolling average of the number of runnable tasks per
+// core.
+func newRunQueue(procRoot string, pollingInterval time.Duration, windowSize int) *polledAverage {
+	if procRoot == "" {
+		procRoot = defaultProcRoot
+	}
+	return newPolledAverage("AverageRunQueue", pollingInterval, windowSize, runQueueSample(procRoot, runtime.NumCPU))
+}
@@ -0,0 +1,65 @@
+package loadshed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	psload "github.com/shirou/gopsutil/load"
+)
+
+func TestLoadAverageSample(t *testing.T) {
+	var source = func() (*psload.AvgStat, error) {
+		return &psload.AvgStat{Load1: 8, Load5: 4, Load15: 2}, nil
+	}
+	var cores = func() int { return 4 }
+	var cases = map[LoadPeriod]float64{Load1: 2, Load5: 1, Load15: .5}
+	for which, expected := range cases {
+		var v, e = loadAverageSample(source, which, cores)()
+		if e != nil {
+			t.Fatal(e)
+		}
+		if v != expected {
+			t.Fatalf("period %d: expected %f but got %f", which, expected, v)
+		}
+	}
+	if _, e := loadAverageSample(source, LoadPeriod(42), cores)(); e == nil {
+		t.Fatal("expected error for invalid period")
+	}
+}
+
+func TestLoadAverageSampleError(t *testing.T) {
+	var source = func() (*psload.AvgStat, error) { return nil, fmt.Errorf("") }
+	if _, e := loadAverageSample(source, Load1, func() int { return 1 })(); e == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseRunQueue(t *testing.T) {
+	var v, e = parseRunQueue("0.50 0.40 0.30 3/512 12345\n")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != 3 {
+		t.Fatalf("wrong runnable count %f", v)
+	}
+	if _, e = parseRunQueue("0.50 0.40"); e == nil {
+		t.Fatal("expected error for short content")
+	}
+	if _, e = parseRunQueue("0.50 0.40 0.30 x/512 1"); e == nil {
+		t.Fatal("expected error for invalid count")
+	}
+}
+
+func TestRunQueue(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "loadavg", "1.00 1.00 1.00 6/300 4000\n")
+	var p = newPolledAverage("test", time.Second, 1, runQueueSample(root, func() int { return 2 }))
+	p.feed()
+	if p.Aggregate().Value != 3 {
+		t.Fatalf("wrong run queue %f", p.Aggregate().Value)
+	}
+	if _, e := runQueueSample(t.TempDir(), func() int { return 1 })(); e == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
@@ -1,8 +1,11 @@
 package loadshed
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/asecurityteam/rolling"
@@ -13,9 +16,37 @@ type Doer interface {
 	Do(func() error) error
 }
 
-// wrapper is an interface representing the loadshed feeders
+// ContextDoer is a Doer that threads a context through to the action. The
+// context given to the action contains the Decision that admitted the call.
+type ContextDoer interface {
+	Doer
+	DoContext(ctx context.Context, runfn func(context.Context) error) error
+}
+
+// WeightedDoer is a Doer that can also be told the relative cost of each
+// call. A call with a cost of N is accounted for as N units of work by the
+// feeders rather than as a single request.
+type WeightedDoer interface {
+	Doer
+	DoWeighted(cost int, runfn func() error) error
+}
+
+// wrapper is an interface representing the loadshed feeders. Track is called
+// when a call is admitted and the returned function is called with the result
+// once the call completes.
 type wrapper interface {
-	Wrap(func() error) func() error
+	Track(cost int) func(error)
+}
+
+// complete finishes tracking a call with its error. It must be deferred. A
+// call that panics is recorded as failed with ErrPanicked and the panic is
+// resumed.
+func complete(done func(error), e *error) {
+	if r := recover(); r != nil {
+		done(fmt.Errorf("%w: %v", ErrPanicked, r))
+		panic(r)
+	}
+	done(*e)
 }
 
 // Option is a partial initializer for Loadshed
@@ -35,7 +66,7 @@ func PercentileLatency(lower float64, upper float64, bucketSize time.Duration, b
 		var w = rolling.NewTimeWindow(bucketSize, buckets, preallocHint)
 		var a = rolling.NewLimitedRollup(requiredPoints, w, rolling.NewPercentageRollup(rolling.NewPercentileRollup(percentile, w, preallocHint, fmt.Sprintf("P%fLatency", percentile)), lower, upper, fmt.Sprintf("ChanceP%fLatency", percentile)))
 		m.aggregators = append(m.aggregators, a)
-		m.chain = append(m.chain, newLatencyTrackingDecorator(w).Wrap)
+		m.chain = append(m.chain, newLatencyTrackingDecorator(w))
 		return m
 	}
 }
@@ -55,7 +86,37 @@ func AverageLatency(lower float64, upper float64, bucketSize time.Duration, buck
 		var w = rolling.NewTimeWindow(bucketSize, buckets, preallocHint)
 		var a = rolling.NewLimitedRollup(requiredPoints, w, rolling.NewPercentageRollup(rolling.NewAverageRollup(w, "AverageLatency"), lower, upper, "ChanceAverageLatency"))
 		m.aggregators = append(m.aggregators, a)
-		m.chain = append(m.chain, newLatencyTrackingDecorator(w).Wrap)
+		m.chain = append(m.chain, newLatencyTrackingDecorator(w))
+		return m
+	}
+}
+
+// EWMALatency generates an option much like AverageLatency except that the
+// average is an exponentially weighted moving average in which the weight of
+// each latency halves every halfLife. Unlike a rolling time window it uses
+// constant memory regardless of the rate of calls and changes smoothly as old
+// latencies decay. Latencies are recorded as measured regardless of the cost
+// of the call. No calls are rejected until the decayed number of recorded
+// calls reaches requiredPoints.
+func EWMALatency(lower float64, upper float64, halfLife time.Duration, requiredPoints int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var a = newEWMA("EWMALatency", halfLife, requiredPoints)
+		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(a, lower, upper, "ChanceEWMALatency"))
+		m.chain = append(m.chain, newEWMALatencyDecorator(a))
+		return m
+	}
+}
+
+// EWMAErrorRate generates an option much like ErrorRate except that the error
+// rate is an exponentially weighted moving average in which the weight of
+// each call halves every halfLife. Each call is weighted by its cost in the
+// error rate but counts once towards requiredPoints. No calls are rejected
+// until the decayed number of recorded calls reaches requiredPoints.
+func EWMAErrorRate(lower float64, upper float64, halfLife time.Duration, requiredPoints int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var a = newEWMA("EWMAErrorRate", halfLife, requiredPoints)
+		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(a, lower, upper, "ChanceEWMAErrorRate"))
+		m.chain = append(m.chain, newEWMAErrorRateDecorator(a))
 		return m
 	}
 }
@@ -78,7 +139,38 @@ func ErrorRate(lower float64, upper float64, bucketSize time.Duration, buckets i
 		var w = newErrRate(errWindow, reqWindow, requiredPoints, "ErrorRate", preallocHint)
 		var a = rolling.NewPercentageRollup(w, lower, upper, "ChanceErrorRate")
 		m.aggregators = append(m.aggregators, a)
-		m.chain = append(m.chain, newErrorRateDecorator(errWindow, reqWindow).Wrap)
+		m.chain = append(m.chain, newErrorRateDecorator(errWindow, reqWindow))
+		return m
+	}
+}
+
+// Throughput generates an option that adds the rate of admitted calls, in
+// calls per second, to the load shedding calculation. Calls are counted with
+// their cost when they are admitted. The rolling window is configured by
+// defining a bucket size and number of buckets and the rate is the number of
+// calls within the window divided by its duration. Because rejected calls are
+// not counted this limits the rate of admitted calls to between lower and
+// upper.
+func Throughput(lower float64, upper float64, bucketSize time.Duration, buckets int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var w = rolling.NewTimeWindow(bucketSize, buckets, defaultHint)
+		var t = newThroughput("Throughput", w, bucketSize*time.Duration(buckets))
+		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(t, lower, upper, "ChanceThroughput"))
+		m.chain = append(m.chain, newThroughputDecorator(w))
+		return m
+	}
+}
+
+// AttemptThroughput generates an option much like Throughput except that
+// every call is counted, including those that are rejected. This measures the
+// rate at which calls arrive rather than the rate at which they are admitted
+// so shedding continues for as long as the arrival rate stays high.
+func AttemptThroughput(lower float64, upper float64, bucketSize time.Duration, buckets int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var w = rolling.NewTimeWindow(bucketSize, buckets, defaultHint)
+		var t = newThroughput("AttemptThroughput", w, bucketSize*time.Duration(buckets))
+		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(t, lower, upper, "ChanceAttemptThroughput"))
+		m.attempts = append(m.attempts, w)
 		return m
 	}
 }
@@ -93,7 +185,76 @@ func Concurrency(lower int, upper int, wg *WaitGroup) Option {
 			wg = NewWaitGroup()
 		}
 		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(wg, float64(lower), float64(upper), "ChanceConcurrency"))
-		m.chain = append(m.chain, newConcurrencyTrackingDecorator(wg).Wrap)
+		m.chain = append(m.chain, newConcurrencyTrackingDecorator(wg))
+		return m
+	}
+}
+
+// Queue generates an option that adds the occupancy of a bounded queue, such
+// as a channel or a worker pool, to the load shedding calculation. The depth
+// function returns the current length and capacity of the queue and the
+// occupancy is the length as a percentage of the capacity. The depth is read
+// each time a call is admitted so it must be cheap and safe for concurrent
+// use. The name identifies the queue in rejection errors.
+func Queue(name string, lower float64, upper float64, depth func() (length int, capacity int)) Option {
+	return func(m *Loadshed) *Loadshed {
+		var q = &queueOccupancy{name: name + "Occupancy", depth: depth}
+		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(q, lower, upper, "Chance"+name))
+		return m
+	}
+}
+
+// FileDescriptors generates an option that adds a rolling average of the
+// number of open file descriptors, as a percentage of the RLIMIT_NOFILE soft
+// limit, to the load shedding calculation. Running out of file descriptors
+// breaks every request rather than some so shedding should begin well before
+// the limit. Open file descriptors are counted from the proc filesystem
+// every pollingInterval. The procRoot is the mount point of the proc
+// filesystem and defaults to /proc when empty.
+func FileDescriptors(lower float64, upper float64, pollingInterval time.Duration, windowSize int, procRoot string) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newFileDescriptors(procRoot, pollingInterval, windowSize)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceFileDescriptors"))
+		return m
+	}
+}
+
+// ListenBacklog generates an option that adds a rolling average of the
+// number of connections waiting in the kernel accept queue of a listening
+// socket to the load shedding calculation. These connections are not yet
+// visible to the Concurrency option. The socket is identified by its listen
+// address, such as ":8080" or "127.0.0.1:8080", and an address without a host
+// or with an unspecified host matches every listening socket on the port. The
+// queue depth is read from the tcp and tcp6 tables of the proc filesystem
+// every pollingInterval. The procRoot is the mount point of the proc
+// filesystem and defaults to /proc when empty. If the address is invalid then
+// every sample fails with an error that is reported to the PollingErrorHook.
+func ListenBacklog(addr string, lower int, upper int, pollingInterval time.Duration, windowSize int, procRoot string) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newListenBacklog(addr, procRoot, pollingInterval, windowSize)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, float64(lower), float64(upper), "ChanceListenBacklog"))
+		return m
+	}
+}
+
+// Goroutines generates an option that adds the number of goroutines to the
+// load shedding calculation. Once the number of goroutines reaches a value
+// between lower and upper the Decorator will begin rejecting new requests
+// based on the distance between the threshold values.
+func Goroutines(lower int, upper int) Option {
+	return func(m *Loadshed) *Loadshed {
+		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(newGoroutines(), float64(lower), float64(upper), "ChanceGoroutines"))
+		return m
+	}
+}
+
+// SmoothedGoroutines generates an option much like Goroutines except that the
+// number of goroutines is sampled every pollingInterval and averaged over the
+// last windowSize samples.
+func SmoothedGoroutines(lower int, upper int, pollingInterval time.Duration, windowSize int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newPolledAverage("AverageGoroutines", pollingInterval, windowSize, goroutineSample)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, float64(lower), float64(upper), "ChanceAverageGoroutines"))
 		return m
 	}
 }
@@ -102,8 +263,238 @@ func Concurrency(lower int, upper int, wg *WaitGroup) Option {
 // load shedding calculation. It will configure the Decorator to reject a
 // percentage of traffic once the average CPU usage is between lower and upper.
 func CPU(lower float64, upper float64, pollingInterval time.Duration, windowSize int) Option {
+	return SampledCPU(lower, upper, pollingInterval, windowSize, newHostCPUSampler())
+}
+
+// SampledCPU generates an option that behaves like the CPU option except that
+// CPU usage is read from the given Sampler every pollingInterval. The sampler
+// must report usage as a percentage between 0 and 100 and must not block for
+// longer than the pollingInterval.
+func SampledCPU(lower float64, upper float64, pollingInterval time.Duration, windowSize int, sampler Sampler) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newAvgCPU(sampler, pollingInterval, windowSize)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceCPU"))
+		return m
+	}
+}
+
+// PerCoreCPU generates an option much like CPU except that the usage of each
+// core is sampled separately and reduced to a single value with the reducer
+// before it is averaged. This detects a single saturated core, such as one
+// running a hot goroutine, which is hidden by the host wide average.
+func PerCoreCPU(lower float64, upper float64, pollingInterval time.Duration, windowSize int, reducer CoreReducer) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newPerCoreCPU(reducer, pollingInterval, windowSize)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "Chance"+perCoreCPUName(reducer)))
+		return m
+	}
+}
+
+// LoadAverage generates an option that adds the system load average, divided
+// by the number of cores, to the load shedding calculation. A value of 1.0
+// means that, on average, there was one runnable task for each core. The
+// load average is read every five seconds, which is how often the kernel
+// recalculates it.
+func LoadAverage(lower float64, upper float64, which LoadPeriod) Option {
 	return func(m *Loadshed) *Loadshed {
-		m.aggregators = append(m.aggregators, rolling.NewPercentageRollup(newAvgCPU(pollingInterval, windowSize), lower, upper, "ChanceCPU"))
+		var p = newLoadAverage(which)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceLoadAverage"))
+		return m
+	}
+}
+
+// RunQueue generates an option that adds a rolling average of the number of
+// runnable tasks, divided by the number of cores, to the load shedding
+// calculation. Unlike the load average this is an instantaneous count read
+// from the loadavg file of the proc filesystem every pollingInterval. The
+// procRoot is the mount point of the proc filesystem and defaults to /proc
+// when empty.
+func RunQueue(lower float64, upper float64, pollingInterval time.Duration, windowSize int, procRoot string) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newRunQueue(procRoot, pollingInterval, windowSize)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceRunQueue"))
+		return m
+	}
+}
+
+// ProcessCPU generates an option much like CPU except that only the CPU time
+// consumed by the current process is measured rather than that of the whole
+// host. Usage is a percentage of the given number of cores. If cores is less
+// than one then the current GOMAXPROCS value is used.
+func ProcessCPU(lower float64, upper float64, pollingInterval time.Duration, windowSize int, cores int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newPolledAverage("AverageProcessCPU", pollingInterval, windowSize, newProcessCPUSampler(cores).sample)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceProcessCPU"))
+		return m
+	}
+}
+
+// SchedulerLatency generates an option that adds Go scheduler latency to the
+// load shedding calculation. Scheduler latency is the time goroutines spend
+// runnable before they are scheduled and is a direct sign that a Go service is
+// CPU saturated. The runtime histogram is polled every pollingInterval and the
+// percentile, given as N%, is computed over the values recorded within the
+// last windowSize polls. The thresholds are in fractional seconds.
+func SchedulerLatency(lower float64, upper float64, pollingInterval time.Duration, windowSize int, percentile float64) Option {
+	return func(m *Loadshed) *Loadshed {
+		var name = fmt.Sprintf("P%fSchedulerLatency", percentile)
+		var p = newPolledAverage(name, pollingInterval, 1, schedLatencySample(readRuntimeSnapshot, percentile, windowSize))
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, fmt.Sprintf("ChanceP%fSchedulerLatency", percentile)))
+		return m
+	}
+}
+
+// GCPressure generates an option that adds a rolling average of the
+// percentage of CPU time spent on garbage collection to the load shedding
+// calculation. The CPU time is sampled every pollingInterval and the time
+// window is defined as windowSize * pollingInterval. This requires Go 1.20 or
+// later; on earlier versions every sample fails with an error that is
+// reported to the PollingErrorHook.
+func GCPressure(lower float64, upper float64, pollingInterval time.Duration, windowSize int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newPolledAverage("AverageGCCPU", pollingInterval, windowSize, gcSample(validateRuntimeMetric))
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceGCCPU"))
+		return m
+	}
+}
+
+// RuntimeMetric generates an option that adds any metric from the
+// runtime/metrics package to the load shedding calculation. The metric is read
+// every pollingInterval and the readings from the last windowSize polls are
+// reduced to a single value by the reducer. Scalar metrics, such as
+// /sched/goroutines:goroutines, can be used with ReduceLatest, ReduceAverage,
+// and ReduceRate. Histogram metrics, such as /gc/pauses:seconds, can be used
+// with ReducePercentile and ReduceMean. If the running version of Go does not
+// support the metric or the reducer does not match the kind of the metric
+// then every sample fails with an error that is reported to the
+// PollingErrorHook.
+func RuntimeMetric(name string, reducer Reducer, lower float64, upper float64, pollingInterval time.Duration, windowSize int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var aggregateName = runtimeMetricName(name, reducer)
+		var sample = runtimeMetricSample(name, reducer, windowSize, readRuntimeSnapshot)
+		if e := validateRuntimeMetric(name, reducer); e != nil {
+			sample = failingSample(e)
+		}
+		var p = newPolledAverage(aggregateName, pollingInterval, 1, sample)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "Chance"+aggregateName))
+		return m
+	}
+}
+
+// ContainerCPU generates an option much like CPU except that usage is read
+// from the cgroup accounting of the container rather than the host and is
+// measured as a percentage of the cgroup CPU quota. If the cgroup has no quota
+// then usage is measured against the number of cores on the host. Both cgroup
+// v1 and v2 are supported. The cgroupRoot is the mount point of the cgroup
+// filesystem and defaults to /sys/fs/cgroup when empty.
+func ContainerCPU(lower float64, upper float64, pollingInterval time.Duration, windowSize int, cgroupRoot string) Option {
+	return func(m *Loadshed) *Loadshed {
+		var c = newContainerCPU(newCgroupCPUSampler(cgroupRoot), pollingInterval, windowSize)
+		m.polled(c.usage.poller, rolling.NewPercentageRollup(c, lower, upper, "ChanceContainerCPU"))
+		return m
+	}
+}
+
+// CPUThrottling generates an option that adds CFS throttling of the container
+// to the load shedding calculation. The throttling is the percentage of
+// enforcement periods within a rolling window of windowSize * pollingInterval
+// in which the cgroup was throttled. Throttling increases latency even when
+// average CPU usage is below the quota. Both cgroup v1 and v2 are supported.
+// The cgroupRoot is the mount point of the cgroup filesystem and defaults to
+// /sys/fs/cgroup when empty.
+func CPUThrottling(lower float64, upper float64, pollingInterval time.Duration, windowSize int, cgroupRoot string) Option {
+	return func(m *Loadshed) *Loadshed {
+		var c = newCPUThrottling(newCgroupCPUSampler(cgroupRoot), pollingInterval, windowSize)
+		m.polled(c.poller, rolling.NewPercentageRollup(c, lower, upper, "ChanceCPUThrottling"))
+		return m
+	}
+}
+
+// Pressure generates an option that adds Linux pressure stall information to
+// the load shedding calculation. The given metric is read from the system wide
+// pressure file of the resource, such as /proc/pressure/cpu, once every
+// pollingInterval. The metric is a percentage of time that tasks were stalled
+// on the resource and is already a running average so no further smoothing
+// is applied.
+func Pressure(resource PressureResource, metric PressureMetric, lower float64, upper float64, pollingInterval time.Duration) Option {
+	return PressureFile(pressurePath(resource), metric, lower, upper, pollingInterval)
+}
+
+// PressureFile generates an option much like Pressure except that the metric
+// is read from the pressure file at path. This can be used to read the
+// pressure of a cgroup v2 group from files such as
+// /sys/fs/cgroup/cpu.pressure.
+func PressureFile(path string, metric PressureMetric, lower float64, upper float64, pollingInterval time.Duration) Option {
+	return func(m *Loadshed) *Loadshed {
+		var name = pressureName(path, metric)
+		var p = newPolledAverage(name, pollingInterval, 1, pressureSample(path, metric))
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "Chance"+name))
+		return m
+	}
+}
+
+// Memory generates an option that adds a rolling average of Go heap memory in
+// use to the load shedding calculation. Usage is measured as a percentage of
+// the memory limit, which is the GOMEMLIMIT soft limit if set, otherwise the
+// cgroup memory limit, otherwise the total memory of the host. It will
+// configure the Decorator to reject a percentage of traffic once the average
+// is between lower and upper.
+func Memory(lower float64, upper float64, pollingInterval time.Duration, windowSize int) Option {
+	return MemoryLimit(lower, upper, pollingInterval, windowSize, MemoryHeap, 0)
+}
+
+// MemoryLimit generates an option much like Memory except that the memory
+// measurement and the limit are given. A limit of zero bytes is detected in
+// the same way as the Memory option.
+func MemoryLimit(lower float64, upper float64, pollingInterval time.Duration, windowSize int, source MemorySource, limit uint64) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newMemory(source, limit, pollingInterval, windowSize)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceMemory"))
+		return m
+	}
+}
+
+// DBPool generates an option that adds a rolling average of database
+// connection pool usage to the load shedding calculation. Usage is the
+// number of connections in use as a percentage of the maximum number of open
+// connections, which must be set with SetMaxOpenConns for the pool to
+// saturate. Requests queue for connections long before CPU usage rises when
+// the pool is exhausted. The pool statistics of db, such as *sql.DB, are read
+// every pollingInterval.
+func DBPool(db DBStatser, lower float64, upper float64, pollingInterval time.Duration, windowSize int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newDBPool(db, pollingInterval, windowSize)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "ChanceDBPool"))
+		return m
+	}
+}
+
+// DBPoolWait generates an option that adds a rolling average of the time
+// callers spend waiting for a database connection to the load shedding
+// calculation. The value is the seconds spent waiting per second between
+// polls, which is the average number of callers waiting for a connection.
+// The rolling average of waits per second is reported alongside it in
+// rejection errors.
+func DBPoolWait(db DBStatser, lower float64, upper float64, pollingInterval time.Duration, windowSize int) Option {
+	return func(m *Loadshed) *Loadshed {
+		var d = newDBPoolWait(&dbWaitSampler{db: db, now: time.Now}, pollingInterval, windowSize)
+		m.polled(d.duration.poller, rolling.NewPercentageRollup(d, lower, upper, "ChanceDBPoolWait"))
+		return m
+	}
+}
+
+// External generates an option that adds a rolling average of a metric
+// produced outside of the process, such as a queue depth written to a file by
+// a sidecar or a gauge exposed by a local agent, to the load shedding
+// calculation. The source is read every pollingInterval and its content is
+// converted to a value by the parser. Reads that take longer than timeout are
+// treated as failed samples and a timeout of zero or less defaults to the
+// pollingInterval. The name identifies the metric in rejection errors. See
+// PollingFallback for handling a source that stops responding.
+func External(name string, source ExternalSource, parser ExternalParser, lower float64, upper float64, pollingInterval time.Duration, windowSize int, timeout time.Duration) Option {
+	return func(m *Loadshed) *Loadshed {
+		var p = newExternal(name, source, parser, pollingInterval, windowSize, timeout)
+		m.polled(p.poller, rolling.NewPercentageRollup(p, lower, upper, "Chance"+name))
 		return m
 	}
 }
@@ -119,6 +510,93 @@ func Aggregator(a rolling.Aggregator) Option {
 	}
 }
 
+// Brownout enables admitting calls that would otherwise be rejected while the
+// rejection probability is at or below the given limit. Such calls are
+// marked as degraded in their Decision so that the action can skip optional
+// work instead of failing outright. Calls are rejected as usual once the
+// probability exceeds the limit.
+func Brownout(limit float64) Option {
+	return func(m *Loadshed) *Loadshed {
+		m.brownout = limit
+		return m
+	}
+}
+
+// Hysteresis smooths the rejection probability after the aggregators are
+// combined to prevent oscillation as clients retry. No calls are rejected
+// until the probability reaches enter, and once started, shedding continues
+// until the probability falls to exit and at least hold has elapsed. The
+// effective probability does not drop until hold has elapsed since shedding
+// started and changes by no more than slewRate per second. A
+// slewRate of zero or less disables the rate limit.
+func Hysteresis(enter float64, exit float64, slewRate float64, hold time.Duration) Option {
+	return func(m *Loadshed) *Loadshed {
+		m.hysteresis = newHysteresis(enter, exit, slewRate, hold)
+		return m
+	}
+}
+
+// TokenHook installs a function that is called when a Token from Acquire is
+// misused. The hook receives ErrTokenReleased when a Token is released more
+// than once and ErrTokenLeaked when a Token is garbage collected without being
+// released.
+func TokenHook(hook func(error)) Option {
+	return func(m *Loadshed) *Loadshed {
+		m.tokenHook = hook
+		return m
+	}
+}
+
+// PollingErrorHook installs a function that is called whenever an option that
+// polls for samples, such as CPU or Memory, fails to record a sample. The hook
+// receives the name of the failing aggregate and the error. ErrStaleSamples is
+// reported once when an option becomes stale as described by PollingFallback.
+// The hook is called from the background polling goroutines and must be safe
+// for concurrent use.
+func PollingErrorHook(hook func(name string, e error)) Option {
+	return func(m *Loadshed) *Loadshed {
+		m.pollingHook = hook
+		return m
+	}
+}
+
+// PollingFallback sets the rejection chance reported by options that poll
+// for samples while those samples cannot be trusted. If staleAfter is zero
+// then an option is unhealthy whenever its most recent sample failed.
+// Otherwise an option is unhealthy once no sample succeeded within staleAfter
+// polling intervals. This also detects a sample source that hangs. The
+// default policy is FallbackHold. With FallbackFull every call is rejected
+// whenever any single option is unhealthy, for example when an option that
+// reads cgroup files runs outside of a container, so every option in use must
+// be able to sample in the environment.
+func PollingFallback(policy FallbackPolicy, staleAfter int) Option {
+	return func(m *Loadshed) *Loadshed {
+		m.fallback = policy
+		m.staleAfter = staleAfter
+		return m
+	}
+}
+
+// PollingTicker replaces the source of the ticks that drive the options that
+// poll for samples. The function is called once for each such option with its
+// polling interval. This is mostly useful in tests that need to control when
+// samples are taken. Tickers are stopped by Close.
+func PollingTicker(newTicker func(pollingInterval time.Duration) Ticker) Option {
+	return func(m *Loadshed) *Loadshed {
+		m.newTicker = newTicker
+		return m
+	}
+}
+
+// polled adds an aggregator whose value depends on the samples of a poller.
+// The poller is started by New once all options are applied so that the
+// polling options apply regardless of their order.
+func (m *Loadshed) polled(p *poller, a rolling.Rollup) {
+	p.name = a.Name()
+	m.pollers = append(m.pollers, p)
+	m.aggregators = append(m.aggregators, &polledAggregator{Rollup: a, poller: p})
+}
+
 var zeroAggregator = rolling.NewSumRollup(rolling.NewPointWindow(1), "Zero")
 
 // Loadshed is a struct containing all the aggregators that rejects a percentage of requests
@@ -126,11 +604,91 @@ var zeroAggregator = rolling.NewSumRollup(rolling.NewPointWindow(1), "Zero")
 type Loadshed struct {
 	random      func() float64
 	aggregators []rolling.Aggregator
-	chain       []func(func() error) func() error
+	chain       []wrapper
+	tokenHook   func(error)
+	brownout    float64
+	hysteresis  *hysteresis
+	attempts    []rolling.Feeder
+	pollers     []*poller
+	pollingHook func(name string, e error)
+	fallback    FallbackPolicy
+	staleAfter  int
+	newTicker   func(time.Duration) Ticker
+	stop        chan struct{}
+	stopOnce    sync.Once
+	polling     sync.WaitGroup
+}
+
+// Decision describes why a call was admitted.
+type Decision struct {
+	// Aggregate is the aggregate with the highest rejection probability.
+	Aggregate *rolling.Aggregate
+	// Probability is the chance, between 0.0 and 1.0, that a call would have
+	// been rejected at the time this call was admitted.
+	Probability float64
+	// Degraded is true if the call would have been rejected but was admitted
+	// because of the Brownout option.
+	Degraded bool
 }
 
 // Do function inputs a function which returns an error
 func (l *Loadshed) Do(runfn func() error) error {
+	return l.DoWeighted(1, runfn)
+}
+
+// DoWeighted behaves like Do except that the call is recorded with the given
+// cost. The cost is added to the concurrency count and the request and error
+// counts of the error rate. Latencies are recorded as measured regardless of
+// the cost. A cost less than one is treated as one.
+func (l *Loadshed) DoWeighted(cost int, runfn func() error) error {
+	if cost < 1 {
+		cost = 1
+	}
+	var _, e = l.admit(cost)
+	if e != nil {
+		return e
+	}
+	defer complete(l.track(cost), &e)
+	e = runfn()
+	return e
+}
+
+// DoContext behaves like Do except that the Decision that admitted the call
+// is added to the context given to the action. It can be retrieved with
+// DecisionFromContext. The cost of the call is read from the context using
+// CostFromContext.
+func (l *Loadshed) DoContext(ctx context.Context, runfn func(context.Context) error) error {
+	var cost = CostFromContext(ctx)
+	var d, e = l.admit(cost)
+	if e != nil {
+		return e
+	}
+	defer complete(l.track(cost), &e)
+	e = runfn(NewDecisionContext(ctx, d))
+	return e
+}
+
+// Acquire is a two phase alternative to Do for work that does not fit in a
+// single function call, such as asynchronous or streaming work. If the call is
+// admitted then the returned Token must be released once the work completes.
+// The cost of the call is read from the context using CostFromContext.
+func (l *Loadshed) Acquire(ctx context.Context) (Token, error) {
+	if e := ctx.Err(); e != nil {
+		return nil, e
+	}
+	var cost = CostFromContext(ctx)
+	if _, e := l.admit(cost); e != nil {
+		return nil, e
+	}
+	return newToken(l.track(cost), l.tokenHook), nil
+}
+
+// admit records the attempt with the given cost, evaluates the aggregators,
+// and returns a Rejected error if the call should be shed.
+func (l *Loadshed) admit(cost int) (*Decision, error) {
+	for _, attempt := range l.attempts {
+		attempt.Feed(float64(cost))
+	}
 	var result *rolling.Aggregate
 	for _, aggregator := range l.aggregators {
 		var r = aggregator.Aggregate()
@@ -138,24 +696,62 @@ func (l *Loadshed) Do(runfn func() error) error {
 			result = r
 		}
 	}
+	if l.hysteresis != nil {
+		result = l.hysteresis.Smooth(result)
+	}
 	var chance = l.random()
+	var d = &Decision{Aggregate: result, Probability: math.Max(0, math.Min(1, result.Value))}
 	if chance < result.Value {
-		return Rejected{Aggregate: result}
+		if result.Value > l.brownout {
+			return nil, Rejected{Aggregate: result}
+		}
+		d.Degraded = true
 	}
-	for _, c := range l.chain {
-		runfn = c(runfn)
+	return d, nil
+}
+
+// track starts tracking an admitted call with all of the feeders. The last
+// feeder installed is the first to see the call start and the last to see it
+// complete.
+func (l *Loadshed) track(cost int) func(error) {
+	var dones = make([]func(error), len(l.chain))
+	for x := len(l.chain) - 1; x >= 0; x = x - 1 {
+		dones[x] = l.chain[x].Track(cost)
+	}
+	return func(e error) {
+		for _, done := range dones {
+			done(e)
+		}
 	}
-	return runfn()
+}
+
+// Close stops the background polling of the options that poll for samples,
+// such as CPU or Memory, and waits for it to finish. Calls are still admitted
+// or rejected after Close using the samples recorded before it.
+func (l *Loadshed) Close() {
+	l.stopOnce.Do(func() {
+		if l.stop != nil {
+			close(l.stop)
+		}
+	})
+	l.polling.Wait()
 }
 
 // New generators a Loadshed struct that sheds load based on some
 // definition of system load
 func New(options ...Option) *Loadshed {
 	var r = rand.New(rand.NewSource(time.Now().UnixNano()))
-	var lo = &Loadshed{random: r.Float64}
+	var lo = &Loadshed{random: r.Float64, newTicker: newTimeTicker, stop: make(chan struct{})}
 	for _, option := range options {
 		lo = option(lo)
 	}
+	for _, p := range lo.pollers {
+		p.hook = lo.pollingHook
+		p.fallback = lo.fallback
+		p.staleAfter = lo.staleAfter
+		lo.polling.Add(1)
+		p.start(lo.newTicker(p.pollingInterval), lo.stop, lo.polling.Done)
+	}
 
 	if len(lo.aggregators) < 1 {
 		lo.aggregators = append(lo.aggregators, zeroAggregator)
@@ -1,6 +1,8 @@
 package loadshed
 
 import (
+	"context"
+	"fmt"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -8,6 +10,17 @@ import (
 	"github.com/asecurityteam/rolling"
 )
 
+// wrap adapts the two phases of a wrapper to a single action.
+func wrap(w wrapper, cost int, next func() error) func() error {
+	return func() error {
+		var done = w.Track(cost)
+		var e error
+		defer complete(done, &e)
+		e = next()
+		return e
+	}
+}
+
 func TestCPUOption(t *testing.T) {
 	var o = CPU(50, 80, time.Second, 10)
 	var l = &Loadshed{}
@@ -16,6 +29,299 @@ func TestCPUOption(t *testing.T) {
 		t.Fatal("cpu option did not add aggregate")
 
 	}
+	o = SampledCPU(50, 80, time.Second, 10, SamplerFunc(func() (float64, error) { return 60, nil }))
+	l = o(l)
+	if len(l.aggregators) != 2 {
+		t.Fatal("sampled cpu option did not add aggregate")
+	}
+}
+
+func TestPerCoreCPUOption(t *testing.T) {
+	var o = PerCoreCPU(50, 80, time.Second, 10, ReduceCoresTop(2))
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("per-core cpu option did not add aggregate")
+	}
+}
+
+func TestLoadAverageOption(t *testing.T) {
+	var o = LoadAverage(1, 2, Load1)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("load average option did not add aggregate")
+	}
+}
+
+func TestRunQueueOption(t *testing.T) {
+	var o = RunQueue(1, 2, time.Second, 10, t.TempDir())
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("run queue option did not add aggregate")
+	}
+}
+
+func TestProcessCPUOption(t *testing.T) {
+	var o = ProcessCPU(50, 80, time.Second, 10, 0)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("process cpu option did not add aggregate")
+	}
+}
+
+func TestSchedulerLatencyOption(t *testing.T) {
+	var o = SchedulerLatency(.001, .01, time.Second, 10, 99)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("scheduler latency option did not add aggregate")
+	}
+}
+
+func TestGCPressureOption(t *testing.T) {
+	var o = GCPressure(10, 50, time.Second, 10)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("gc pressure option did not add aggregate")
+	}
+}
+
+func TestRuntimeMetricOption(t *testing.T) {
+	var o = RuntimeMetric("/gc/pauses:seconds", ReducePercentile(99), .01, .1, time.Second, 10)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("runtime metric option did not add aggregate")
+	}
+	if len(l.pollers) != 1 {
+		t.Fatal("runtime metric option did not add poller")
+	}
+	if _, e := l.pollers[0].sample(); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestRuntimeMetricOptionInvalid(t *testing.T) {
+	var failed = make(chan error, 1)
+	var l = New(
+		RuntimeMetric("/gc/pauses:seconds", ReduceLatest(), .01, .1, time.Hour, 10),
+		PollingErrorHook(func(name string, e error) {
+			select {
+			case failed <- e:
+			default:
+			}
+		}),
+	)
+	if e := <-failed; e == nil {
+		t.Fatal("expected error for mismatched reducer")
+	}
+	l.Close()
+}
+
+func TestContainerCPUOption(t *testing.T) {
+	var o = ContainerCPU(50, 80, time.Second, 10, t.TempDir())
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("container cpu option did not add aggregate")
+	}
+}
+
+func TestCPUThrottlingOption(t *testing.T) {
+	var o = CPUThrottling(10, 50, time.Second, 10, t.TempDir())
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("cpu throttling option did not add aggregate")
+	}
+}
+
+func TestPressureOption(t *testing.T) {
+	var o = Pressure(PressureCPU, PressureSomeAvg10, 10, 50, time.Second)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("pressure option did not add aggregate")
+	}
+	l = Pressure(PressureMemory, PressureSomeAvg10, 10, 50, time.Second)(l)
+	var cpu, memory = l.aggregators[0].(rolling.Rollup).Name(), l.aggregators[1].(rolling.Rollup).Name()
+	if cpu != "ChancePressureCpuSomeAvg10" || memory != "ChancePressureMemorySomeAvg10" {
+		t.Fatalf("pressure options are not distinguishable: %s %s", cpu, memory)
+	}
+}
+
+func TestMemoryOption(t *testing.T) {
+	var o = Memory(50, 80, time.Second, 10)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("memory option did not add aggregate")
+	}
+}
+
+func TestDBPoolOptions(t *testing.T) {
+	var db = &fakeDBStats{}
+	var l = &Loadshed{}
+	l = DBPool(db, 50, 90, time.Second, 10)(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("db pool option did not add aggregate")
+	}
+	l = DBPoolWait(db, 1, 10, time.Second, 10)(l)
+	if len(l.aggregators) != 2 {
+		t.Fatal("db pool wait option did not add aggregate")
+	}
+}
+
+func TestExternalOption(t *testing.T) {
+	var o = External("SidecarQueue", FileSource("queue", 0), ParseNumber(), 10, 100, time.Second, 10, 0)
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("external option did not add aggregate")
+	}
+	if name := l.aggregators[0].(rolling.Rollup).Name(); name != "ChanceSidecarQueue" {
+		t.Fatalf("wrong aggregate name %s", name)
+	}
+}
+
+func TestQueueOption(t *testing.T) {
+	var ch = make(chan int, 10)
+	var o = Queue("Work", 50, 100, ChannelDepth(ch))
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("queue option did not add aggregate")
+	}
+	for x := 0; x < 8; x = x + 1 {
+		ch <- x
+	}
+	if v := l.aggregators[0].Aggregate().Value; v != .6 {
+		t.Fatalf("unexpected rejection chance %f", v)
+	}
+}
+
+func TestFileDescriptorsOption(t *testing.T) {
+	var o = FileDescriptors(50, 80, time.Second, 10, t.TempDir())
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("file descriptors option did not add aggregate")
+	}
+}
+
+func TestListenBacklogOption(t *testing.T) {
+	var o = ListenBacklog(":8080", 10, 100, time.Second, 10, t.TempDir())
+	var l = &Loadshed{}
+	l = o(l)
+	if len(l.aggregators) != 1 {
+		t.Fatal("listen backlog option did not add aggregate")
+	}
+}
+
+func TestListenBacklogOptionInvalid(t *testing.T) {
+	var failed = make(chan error, 1)
+	var l = New(
+		ListenBacklog("8080", 10, 100, time.Hour, 10, t.TempDir()),
+		PollingErrorHook(func(name string, e error) {
+			select {
+			case failed <- e:
+			default:
+			}
+		}),
+	)
+	if e := <-failed; e == nil {
+		t.Fatal("expected error for invalid address")
+	}
+	l.Close()
+}
+
+func TestPollingOptions(t *testing.T) {
+	var failed = make(chan string, 1)
+	var sampler = SamplerFunc(func() (float64, error) { return 0, fmt.Errorf("fail") })
+	var l = New(
+		SampledCPU(50, 80, time.Hour, 10, sampler),
+		PollingFallback(FallbackFull, 0),
+		PollingErrorHook(func(name string, e error) {
+			select {
+			case failed <- name:
+			default:
+			}
+		}),
+	)
+	if name := <-failed; name != "ChanceCPU" {
+		t.Fatalf("wrong aggregate name reported %s", name)
+	}
+	var e = l.Do(func() error { return nil })
+	switch e.(type) {
+	case Rejected:
+		//pass
+	default:
+		t.Fatalf("expected rejection from unhealthy option got %v", e)
+	}
+	l.Close()
+}
+
+func TestLoadshedClose(t *testing.T) {
+	var l = New()
+	l.Close()
+	l.Close()
+	if e := l.Do(func() error { return nil }); e != nil {
+		t.Fatalf("Unexpected error %s", e)
+	}
+	(&Loadshed{}).Close()
+}
+
+func TestGoroutinesOption(t *testing.T) {
+	var o = Goroutines(5000, 10000)
+	var m = &Loadshed{}
+	m = o(m)
+	if len(m.aggregators) != 1 {
+		t.Fatal("goroutines option did not add aggregate")
+	}
+	if m.aggregators[0].Aggregate().Value != 0 {
+		t.Fatalf("unexpected rejection chance %f", m.aggregators[0].Aggregate().Value)
+	}
+	o = SmoothedGoroutines(5000, 10000, time.Second, 10)
+	m = o(m)
+	if len(m.aggregators) != 2 {
+		t.Fatal("smoothed goroutines option did not add aggregate")
+	}
+}
+
+func TestThroughputOption(t *testing.T) {
+	var o = Throughput(100, 200, time.Second, 10)
+	var m = &Loadshed{}
+	m = o(m)
+	if len(m.aggregators) != 1 {
+		t.Fatal("throughput option did not add aggregate")
+	}
+	if len(m.chain) != 1 {
+		t.Fatal("throughput option did not add chain")
+	}
+}
+
+func TestAttemptThroughputOption(t *testing.T) {
+	var option = &fakeOption{err: true}
+	var l = New(option.Option(), AttemptThroughput(100, 200, time.Second, 10))
+	for x := 0; x < 2; x = x + 1 {
+		if e := l.DoWeighted(3, func() error { return nil }); e == nil {
+			t.Fatal("Did not get expected error")
+		}
+	}
+	if _, e := l.Acquire(context.Background()); e == nil {
+		t.Fatal("Did not get expected error")
+	}
+	if len(l.chain) != 0 {
+		t.Fatal("attempt throughput option added chain")
+	}
+	var count = l.aggregators[1].Aggregate().Source.Source.Value
+	if count != 7 {
+		t.Fatalf("rejected attempts were not counted: %f", count)
+	}
 }
 
 func TestConcurrencyOption(t *testing.T) {
@@ -68,6 +374,18 @@ func TestLoadshedAggregator(t *testing.T) {
 	}
 }
 
+func TestEWMAOptions(t *testing.T) {
+	var m = &Loadshed{}
+	m = EWMALatency(.1, 1, time.Second, 10)(m)
+	if len(m.aggregators) != 1 || len(m.chain) != 1 {
+		t.Fatal("ewma latency option did not add aggregate and chain")
+	}
+	m = EWMAErrorRate(50, 75, time.Second, 10)(m)
+	if len(m.aggregators) != 2 || len(m.chain) != 2 {
+		t.Fatal("ewma error rate option did not add aggregate and chain")
+	}
+}
+
 func TestErrorRateOption(t *testing.T) {
 	var o = ErrorRate(50, 75, time.Millisecond, 10, 10, 1)
 	var m = &Loadshed{}
@@ -92,6 +410,152 @@ func TestLoadshed(t *testing.T) {
 	}
 }
 
+func TestLoadshedDoWeighted(t *testing.T) {
+	var wg = NewWaitGroup()
+	var l = New(Concurrency(100, 200, wg))
+	var e = l.DoWeighted(10, func() error {
+		if wg.Aggregate().Value != 10 {
+			t.Fatalf("wrong concurrency count: %f", wg.Aggregate().Value)
+		}
+		return nil
+	})
+	if e != nil {
+		t.Fatalf("Unexpected error %s", e)
+	}
+	e = l.DoWeighted(0, func() error {
+		if wg.Aggregate().Value != 1 {
+			t.Fatalf("wrong concurrency count: %f", wg.Aggregate().Value)
+		}
+		return nil
+	})
+	if e != nil {
+		t.Fatalf("Unexpected error %s", e)
+	}
+	if wg.Aggregate().Value != 0 {
+		t.Fatalf("wrong concurrency count: %f", wg.Aggregate().Value)
+	}
+}
+
+func TestLoadshedPanic(t *testing.T) {
+	var wg = NewWaitGroup()
+	var window = rolling.NewPointWindow(1)
+	var l = New(Concurrency(100, 200, wg))
+	l.chain = append(l.chain, newErrorRateDecorator(window, rolling.NewPointWindow(1)))
+	var calls = []func(){
+		func() { _ = l.DoWeighted(2, func() error { panic("boom") }) },
+		func() {
+			_ = l.DoContext(context.Background(), func(context.Context) error { panic("boom") })
+		},
+	}
+	for _, call := range calls {
+		window.Feed(0)
+		func() {
+			defer func() {
+				if r := recover(); r != "boom" {
+					t.Fatalf("panic was not resumed: %v", r)
+				}
+			}()
+			call()
+		}()
+		if wg.Aggregate().Value != 0 {
+			t.Fatalf("panicking call was not completed: %f", wg.Aggregate().Value)
+		}
+		if rolling.NewSumRollup(window, "").Aggregate().Value == 0 {
+			t.Fatal("panicking call was not recorded as an error")
+		}
+	}
+}
+
+func TestLoadshedAcquire(t *testing.T) {
+	var wg = NewWaitGroup()
+	var l = New(Concurrency(100, 200, wg))
+	var tk, e = l.Acquire(NewCostContext(context.Background(), 3))
+	if e != nil {
+		t.Fatalf("Unexpected error %s", e)
+	}
+	if wg.Aggregate().Value != 3 {
+		t.Fatalf("wrong concurrency count: %f", wg.Aggregate().Value)
+	}
+	tk.Release(nil)
+	if wg.Aggregate().Value != 0 {
+		t.Fatalf("wrong concurrency count: %f", wg.Aggregate().Value)
+	}
+}
+
+func TestLoadshedAcquireRejected(t *testing.T) {
+	var option = &fakeOption{err: true}
+	var l = New(option.Option())
+	var tk, e = l.Acquire(context.Background())
+	switch e.(type) {
+	case Rejected:
+		//pass
+	default:
+		t.Fatal("Did not get expected error")
+	}
+	if tk != nil {
+		t.Fatal("Got token for rejected call")
+	}
+}
+
+func TestLoadshedAcquireCanceled(t *testing.T) {
+	var l = New()
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	var _, e = l.Acquire(ctx)
+	if e != context.Canceled {
+		t.Fatalf("Did not get expected error: %v", e)
+	}
+}
+
+func TestLoadshedDoContext(t *testing.T) {
+	var l = New()
+	var e = l.DoContext(context.Background(), func(ctx context.Context) error {
+		var d = DecisionFromContext(ctx)
+		if d == nil {
+			t.Fatal("decision not added to context")
+		}
+		if d.Degraded {
+			t.Fatal("unexpected degraded decision")
+		}
+		return nil
+	})
+	if e != nil {
+		t.Fatalf("Unexpected error %s", e)
+	}
+}
+
+func TestLoadshedBrownout(t *testing.T) {
+	var option = &fakeOption{err: true}
+	var l = New(option.Option(), Brownout(1))
+	var e = l.DoContext(context.Background(), func(ctx context.Context) error {
+		var d = DecisionFromContext(ctx)
+		if d == nil || !d.Degraded {
+			t.Fatal("call not marked as degraded")
+		}
+		if d.Probability != 1 {
+			t.Fatalf("wrong rejection probability %f", d.Probability)
+		}
+		return nil
+	})
+	if e != nil {
+		t.Fatalf("Unexpected error %s", e)
+	}
+}
+
+func TestLoadshedBrownoutExceeded(t *testing.T) {
+	var option = &fakeOption{err: true}
+	var l = New(option.Option(), Brownout(.5))
+	var e = l.DoContext(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+	switch e.(type) {
+	case Rejected:
+		//pass
+	default:
+		t.Fatal("Did not get expected error")
+	}
+}
+
 func TestLoadshedRequestRejected(t *testing.T) {
 	var option = &fakeOption{err: true}
 	var l = New(option.Option())
@@ -0,0 +1,164 @@
+package loadshed
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	psmem "github.com/shirou/gopsutil/mem"
+	psprocess "github.com/shirou/gopsutil/process"
+)
+
+// MemorySource selects the memory measurement used by the MemoryLimit option.
+type MemorySource int
+
+const (
+	// MemoryHeap measures the bytes of Go heap memory in use, including
+	// fragmentation within heap spans.
+	MemoryHeap MemorySource = iota
+	// MemoryRSS measures the resident set size of the process.
+	MemoryRSS
+)
+
+var heapMetrics = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/unused:bytes",
+}
+
+// heapInUse reads the bytes of heap memory in use from the runtime.
+func heapInUse() (uint64, error) {
+	var samples = make([]metrics.Sample, len(heapMetrics))
+	for x, name := range heapMetrics {
+		samples[x].Name = name
+	}
+	metrics.Read(samples)
+	var total uint64
+	for _, sample := range samples {
+		if sample.Value.Kind() != metrics.KindUint64 {
+			return 0, fmt.Errorf("runtime metric %s is not supported", sample.Name)
+		}
+		total = total + sample.Value.Uint64()
+	}
+	return total, nil
+}
+
+// processRSS reads the resident set size of the current process.
+func processRSS() (uint64, error) {
+	var p, e = psprocess.NewProcess(int32(os.Getpid()))
+	if e != nil {
+		return 0, e
+	}
+	var info, ierr = p.MemoryInfo()
+	if ierr != nil {
+		return 0, ierr
+	}
+	return info.RSS, nil
+}
+
+// memoryLimitRefresh is how long a cgroup or host memory limit is cached
+// before it is read again.
+var memoryLimitRefresh = time.Minute
+
+// softMemoryLimit returns the limit set by GOMEMLIMIT, or zero if none is set.
+func softMemoryLimit() uint64 {
+	if limit := debug.SetMemoryLimit(-1); limit > 0 && limit < math.MaxInt64 {
+		return uint64(limit)
+	}
+	return 0
+}
+
+// systemMemoryLimit returns the limit of the cgroup mounted at cgroupRoot, or
+// the total memory of the host if there is no cgroup limit.
+func systemMemoryLimit(cgroupRoot string) (uint64, error) {
+	if limit, e := cgroupMemoryLimit(cgroupRoot); e == nil && limit > 0 {
+		return limit, nil
+	}
+	var v, e = psmem.VirtualMemory()
+	if e != nil {
+		return 0, e
+	}
+	return v.Total, nil
+}
+
+// cachedMemoryLimit determines the memory available to the process. The soft
+// limit set by GOMEMLIMIT is preferred, then the limit of the cgroup mounted at
+// cgroupRoot, and finally the total memory of the host. GOMEMLIMIT is cheap to
+// read and is checked on every call so that changes made at runtime are
+// respected immediately. The cgroup or host limit is only read again once
+// refresh has passed.
+type cachedMemoryLimit struct {
+	cgroupRoot string
+	refresh    time.Duration
+	system     func(string) (uint64, error)
+	now        func() time.Time
+	lock       *sync.Mutex
+	limit      uint64
+	resolved   time.Time
+}
+
+func (c *cachedMemoryLimit) Limit() (uint64, error) {
+	if limit := softMemoryLimit(); limit > 0 {
+		return limit, nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var now = c.now()
+	if c.limit == 0 || now.Sub(c.resolved) >= c.refresh {
+		var limit, e = c.system(c.cgroupRoot)
+		if e != nil {
+			return 0, e
+		}
+		c.limit = limit
+		c.resolved = now
+	}
+	return c.limit, nil
+}
+
+func newCachedMemoryLimit(cgroupRoot string, refresh time.Duration) *cachedMemoryLimit {
+	return &cachedMemoryLimit{
+		cgroupRoot: cgroupRoot,
+		refresh:    refresh,
+		system:     systemMemoryLimit,
+		now:        time.Now,
+		lock:       &sync.Mutex{},
+	}
+}
+
+// memoryPercent generates a sample function that reports the memory in use as
+// a percentage of the limit.
+func memoryPercent(used func() (uint64, error), limit func() (uint64, error)) func() (float64, error) {
+	return func() (float64, error) {
+		var l, e = limit()
+		if e != nil {
+			return 0, e
+		}
+		if l == 0 {
+			return 0, fmt.Errorf("memory limit is zero")
+		}
+		var u, uerr = used()
+		if uerr != nil {
+			return 0, uerr
+		}
+		return float64(u) / float64(l) * 100, nil
+	}
+}
+
+// newMemory tracks a rolling average of memory usage as a percentage of the
+// limit. A limit of zero is detected with a cachedMemoryLimit.
+func newMemory(source MemorySource, limit uint64, pollingInterval time.Duration, windowSize int) *polledAverage {
+	var limitFn = func() (uint64, error) { return limit, nil }
+	if limit == 0 {
+		limitFn = newCachedMemoryLimit(defaultCgroupRoot, memoryLimitRefresh).Limit
+	}
+	var used = heapInUse
+	var name = "AverageHeapMemory"
+	if source == MemoryRSS {
+		used = processRSS
+		name = "AverageRSSMemory"
+	}
+	return newPolledAverage(name, pollingInterval, windowSize, memoryPercent(used, limitFn))
+}
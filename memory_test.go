@@ -0,0 +1,107 @@
+package loadshed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHeapInUse(t *testing.T) {
+	var used, e = heapInUse()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if used == 0 {
+		t.Fatal("heap in use is zero")
+	}
+}
+
+func TestProcessRSS(t *testing.T) {
+	var used, e = processRSS()
+	if e != nil {
+		t.Skipf("rss not available on this platform: %s", e)
+	}
+	if used == 0 {
+		t.Fatal("rss is zero")
+	}
+}
+
+func TestDetectMemoryLimit(t *testing.T) {
+	var limit, e = newCachedMemoryLimit(t.TempDir(), time.Minute).Limit()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if limit == 0 {
+		t.Fatal("detected limit is zero")
+	}
+}
+
+func TestCachedMemoryLimit(t *testing.T) {
+	if softMemoryLimit() > 0 {
+		t.Skip("GOMEMLIMIT is set")
+	}
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var reads = 0
+	var c = newCachedMemoryLimit(t.TempDir(), time.Minute)
+	c.now = clock.Now
+	c.system = func(string) (uint64, error) {
+		reads = reads + 1
+		return uint64(reads), nil
+	}
+	for x := 0; x < 3; x = x + 1 {
+		if limit, _ := c.Limit(); limit != 1 {
+			t.Fatalf("limit was not cached: %d", limit)
+		}
+	}
+	clock.Advance(time.Minute)
+	if limit, _ := c.Limit(); limit != 2 {
+		t.Fatalf("limit was not refreshed: %d", limit)
+	}
+	c.system = func(string) (uint64, error) { return 0, fmt.Errorf("fail") }
+	clock.Advance(time.Minute)
+	if _, e := c.Limit(); e == nil {
+		t.Fatal("expected error from limit")
+	}
+}
+
+func TestMemoryPercent(t *testing.T) {
+	var sample = memoryPercent(
+		func() (uint64, error) { return 256, nil },
+		func() (uint64, error) { return 1024, nil },
+	)
+	var value, e = sample()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if value != 25 {
+		t.Fatalf("wrong percentage %f", value)
+	}
+}
+
+func TestMemoryPercentErrors(t *testing.T) {
+	var ok = func() (uint64, error) { return 1, nil }
+	var zero = func() (uint64, error) { return 0, nil }
+	var fail = func() (uint64, error) { return 0, fmt.Errorf("") }
+	if _, e := memoryPercent(ok, fail)(); e == nil {
+		t.Fatal("expected error from limit")
+	}
+	if _, e := memoryPercent(ok, zero)(); e == nil {
+		t.Fatal("expected error from zero limit")
+	}
+	if _, e := memoryPercent(fail, ok)(); e == nil {
+		t.Fatal("expected error from usage")
+	}
+}
+
+func TestMemoryPolling(t *testing.T) {
+	var m = newMemory(MemoryHeap, 1<<40, time.Millisecond, 1)
+	startPoller(t, m.poller)
+	var deadline = time.Now().Add(time.Second)
+	for m.Aggregate().Value == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	var result = m.Aggregate().Value
+	if result <= 0 || result > 100 {
+		t.Fatalf("invalid memory percentage: %f", result)
+	}
+}
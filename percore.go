@@ -0,0 +1,121 @@
+package loadshed
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	pscpu "github.com/shirou/gopsutil/cpu"
+)
+
+// CoreReducer reduces the usage of each core to a single value. Reducers are
+// created with ReduceCoresMax, ReduceCoresPercentile, and ReduceCoresTop.
+type CoreReducer struct {
+	name   string
+	reduce func(sorted []float64) float64
+}
+
+// ReduceCoresMax reduces per-core usage to the usage of the busiest core.
+func ReduceCoresMax() CoreReducer {
+	return CoreReducer{name: "Max", reduce: func(sorted []float64) float64 {
+		return sorted[len(sorted)-1]
+	}}
+}
+
+// ReduceCoresPercentile reduces per-core usage to the given percentile, as N%,
+// of the usage across cores.
+func ReduceCoresPercentile(percentile float64) CoreReducer {
+	return CoreReducer{name: fmt.Sprintf("P%f", percentile), reduce: func(sorted []float64) float64 {
+		var rank = int(math.Ceil(percentile / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		if rank > len(sorted) {
+			rank = len(sorted)
+		}
+		return sorted[rank-1]
+	}}
+}
+
+// ReduceCoresTop reduces per-core usage to the average usage of the n busiest
+// cores. All cores are averaged if there are fewer than n. If n is less than
+// one then the busiest core is used.
+func ReduceCoresTop(n int) CoreReducer {
+	if n < 1 {
+		n = 1
+	}
+	return CoreReducer{name: fmt.Sprintf("Top%d", n), reduce: func(sorted []float64) float64 {
+		var top = sorted
+		if n < len(sorted) {
+			top = sorted[len(sorted)-n:]
+		}
+		var sum = 0.0
+		for _, v := range top {
+			sum = sum + v
+		}
+		return sum / float64(len(top))
+	}}
+}
+
+// perCoreCPUSampler reports the usage of each host core since the previous
+// sample reduced to a single percentage between 0 and 100. Cores whose times
+// did not advance are left out of the reduction.
+type perCoreCPUSampler struct {
+	times   func() ([]pscpu.TimesStat, error)
+	reducer CoreReducer
+	last    []pscpu.TimesStat
+}
+
+func (s *perCoreCPUSampler) Sample() (float64, error) {
+	var times, e = s.times()
+	if e != nil {
+		return 0, e
+	}
+	if len(times) < 1 {
+		return 0, fmt.Errorf("no cpu times reported")
+	}
+	var last = s.last
+	s.last = times
+	if len(last) != len(times) {
+		// The set of cores changed so the readings cannot be compared.
+		return 0, errNoBaseline
+	}
+	var usage = make([]float64, 0, len(times))
+	var stalled error
+	for x := range times {
+		var busy, berr = cpuBusy(last[x], times[x])
+		if berr != nil {
+			// A core whose times did not advance, such as an offline core,
+			// is skipped rather than failing the whole sample.
+			stalled = berr
+			continue
+		}
+		usage = append(usage, busy)
+	}
+	if len(usage) < 1 {
+		return 0, stalled
+	}
+	sort.Float64s(usage)
+	return s.reducer.reduce(usage), nil
+}
+
+// newPerCoreCPUSampler generates a Sampler that reads the CPU times of each
+// host core using gopsutil.
+func newPerCoreCPUSampler(reducer CoreReducer) *perCoreCPUSampler {
+	return &perCoreCPUSampler{
+		times:   func() ([]pscpu.TimesStat, error) { return pscpu.Times(true) },
+		reducer: reducer,
+	}
+}
+
+// newPerCoreCPU tracks a rolling average of the reduced per-core CPU usage.
+// The time window is defined as windowSize * pollingInterval.
+func newPerCoreCPU(reducer CoreReducer, pollingInterval time.Duration, windowSize int) *polledAverage {
+	return newPolledAverage(perCoreCPUName(reducer), pollingInterval, windowSize, newPerCoreCPUSampler(reducer).Sample)
+}
+
+// perCoreCPUName generates the aggregate name for per-core CPU usage.
+func perCoreCPUName(reducer CoreReducer) string {
+	return fmt.Sprintf("Average%sCoreCPU", reducer.name)
+}
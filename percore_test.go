@@ -0,0 +1,75 @@
+package loadshed
+
+import (
+	"fmt"
+	"testing"
+
+	pscpu "github.com/shirou/gopsutil/cpu"
+)
+
+func TestCoreReducers(t *testing.T) {
+	var usage = []float64{10, 20, 30, 90}
+	var tc = []struct {
+		reducer  CoreReducer
+		expected float64
+	}{
+		{ReduceCoresMax(), 90},
+		{ReduceCoresPercentile(50), 20},
+		{ReduceCoresPercentile(75), 30},
+		{ReduceCoresPercentile(100), 90},
+		{ReduceCoresPercentile(0), 10},
+		{ReduceCoresTop(2), 60},
+		{ReduceCoresTop(10), 37.5},
+		{ReduceCoresTop(0), 90},
+	}
+	for _, c := range tc {
+		if v := c.reducer.reduce(usage); v != c.expected {
+			t.Fatalf("%s: expected %f got %f", c.reducer.name, c.expected, v)
+		}
+	}
+}
+
+func TestPerCoreCPUSampler(t *testing.T) {
+	var times = [][]pscpu.TimesStat{
+		{{User: 0, Idle: 0}, {User: 0, Idle: 0}},
+		{{User: 90, Idle: 10}, {User: 10, Idle: 90}},
+		{{User: 90, Idle: 10}},
+		{{User: 90, Idle: 10}},
+	}
+	var s = &perCoreCPUSampler{reducer: ReduceCoresMax(), times: func() ([]pscpu.TimesStat, error) {
+		var v = times[0]
+		times = times[1:]
+		return v, nil
+	}}
+	if _, e := s.Sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline got %v", e)
+	}
+	var v, e = s.Sample()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != 90 {
+		t.Fatalf("wrong per-core cpu percentage %f", v)
+	}
+	if _, e = s.Sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline after core change got %v", e)
+	}
+	if _, e = s.Sample(); e == nil {
+		t.Fatal("expected error when cpu times do not advance")
+	}
+	s.last = []pscpu.TimesStat{{User: 0, Idle: 0}, {User: 10, Idle: 10}, {User: 0, Idle: 0}}
+	s.times = func() ([]pscpu.TimesStat, error) {
+		return []pscpu.TimesStat{{User: 10, Idle: 90}, {User: 10, Idle: 10}, {User: 30, Idle: 70}}, nil
+	}
+	if v, e = s.Sample(); e != nil || v != 30 {
+		t.Fatalf("stalled core was not skipped: %f %v", v, e)
+	}
+	s.times = func() ([]pscpu.TimesStat, error) { return nil, nil }
+	if _, e = s.Sample(); e == nil {
+		t.Fatal("expected error for empty cpu times")
+	}
+	s.times = func() ([]pscpu.TimesStat, error) { return nil, fmt.Errorf("") }
+	if _, e = s.Sample(); e == nil {
+		t.Fatal("expected error from cpu times")
+	}
+}
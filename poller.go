@@ -0,0 +1,233 @@
+package loadshed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// FallbackPolicy determines the rejection chance reported by an option that
+// polls for samples while its samples are failing or stale.
+type FallbackPolicy int
+
+const (
+	// FallbackHold keeps reporting the rolling window of the last successful
+	// samples. This is the default.
+	FallbackHold FallbackPolicy = iota
+	// FallbackZero treats the option as idle so that it rejects nothing.
+	FallbackZero
+	// FallbackFull treats the option as fully loaded so that it rejects
+	// everything.
+	FallbackFull
+)
+
+// poller periodically samples some value, such as memory or resource usage,
+// and feeds it into a window.
+type poller struct {
+	name            string
+	pollingInterval time.Duration
+	sample          func() (float64, error)
+	feeder          rolling.Feeder
+	hook            func(name string, e error)
+	fallback        FallbackPolicy
+	staleAfter      int
+	now             func() time.Time
+
+	lock        sync.Mutex
+	lastSuccess time.Time
+	failing     bool
+	stale       bool
+}
+
+func newPoller(pollingInterval time.Duration, sample func() (float64, error), feeder rolling.Feeder) *poller {
+	return &poller{
+		pollingInterval: pollingInterval,
+		sample:          sample,
+		feeder:          feeder,
+		now:             time.Now,
+		lastSuccess:     time.Now(),
+	}
+}
+
+// failingSample generates a sample function that always fails with the given
+// error. It is used by options that detect an invalid configuration when they
+// are installed so that the error is reported through the polling hook.
+func failingSample(e error) func() (float64, error) {
+	return func() (float64, error) {
+		return 0, e
+	}
+}
+
+// Ticker delivers the ticks that drive the options that poll for samples.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker. No ticks are delivered after Stop returns.
+	Stop()
+}
+
+// timeTicker adapts a time.Ticker to the Ticker interface.
+type timeTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *timeTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *timeTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// newTimeTicker generates the default Ticker which ticks once every interval.
+func newTimeTicker(interval time.Duration) Ticker {
+	return &timeTicker{ticker: time.NewTicker(interval)}
+}
+
+// poll records a sample immediately and then once for every tick until the
+// ticks channel is closed or stop is closed.
+func (p *poller) poll(ticks <-chan time.Time, stop <-chan struct{}) {
+	p.feed()
+	for {
+		select {
+		case <-stop:
+			return
+		case _, ok := <-ticks:
+			if !ok {
+				return
+			}
+			p.feed()
+		}
+	}
+}
+
+// start polls in the background for every tick of the ticker until stop is
+// closed. The ticker is then stopped and done is called.
+func (p *poller) start(ticker Ticker, stop <-chan struct{}, done func()) {
+	p.lock.Lock()
+	p.lastSuccess = p.now()
+	p.lock.Unlock()
+	go func() {
+		defer done()
+		defer ticker.Stop()
+		p.poll(ticker.C(), stop)
+	}()
+}
+
+// feed records a new sample. Samples that fail are reported to the hook and
+// skipped so that the window is not polluted with invalid data. A sample that
+// has no baseline to compare against is skipped but still shows that the
+// source is alive, which keeps an idle source from becoming stale.
+func (p *poller) feed() {
+	var value, e = p.safeSample()
+	if e == errNoBaseline {
+		p.alive()
+		return
+	}
+	if e != nil {
+		p.lock.Lock()
+		p.failing = true
+		p.lock.Unlock()
+		p.report(e)
+		return
+	}
+	p.feeder.Feed(value)
+	p.alive()
+}
+
+// alive records that the sample source responded.
+func (p *poller) alive() {
+	p.lock.Lock()
+	p.lastSuccess = p.now()
+	p.failing = false
+	p.stale = false
+	p.lock.Unlock()
+}
+
+// safeSample converts a panic in the sample function into an error so that
+// a faulty source does not crash the background goroutine.
+func (p *poller) safeSample() (value float64, e error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, e = 0, fmt.Errorf("sample panicked: %v", r)
+		}
+	}()
+	return p.sample()
+}
+
+func (p *poller) report(e error) {
+	if p.hook != nil {
+		p.hook(p.name, e)
+	}
+}
+
+// healthy reports whether the samples can be trusted. If staleAfter is zero
+// then the poller is unhealthy while the most recent sample failed. Otherwise
+// it is unhealthy once no sample succeeded within staleAfter polling
+// intervals, which tolerates occasional failures. The hook is notified with
+// ErrStaleSamples when the poller first becomes stale.
+func (p *poller) healthy() bool {
+	p.lock.Lock()
+	if p.staleAfter < 1 {
+		var failing = p.failing
+		p.lock.Unlock()
+		return !failing
+	}
+	var stale = p.now().Sub(p.lastSuccess) > time.Duration(p.staleAfter)*p.pollingInterval
+	var notify = stale && !p.stale
+	p.stale = stale
+	p.lock.Unlock()
+	if notify {
+		p.report(ErrStaleSamples)
+	}
+	return !stale
+}
+
+// polledAverage is a rolling average Aggregator fed by a poller.
+type polledAverage struct {
+	*poller
+	rollup rolling.Rollup
+}
+
+// Name emits the rollup name for identification.
+func (p *polledAverage) Name() string {
+	return p.rollup.Name()
+}
+
+// Aggregate emits the current rolling average of the samples.
+func (p *polledAverage) Aggregate() *rolling.Aggregate {
+	return p.rollup.Aggregate()
+}
+
+// newPolledAverage tracks a rolling average of the given sample function. The
+// time window is defined as windowSize * pollingInterval. The poller must be
+// started separately.
+func newPolledAverage(name string, pollingInterval time.Duration, windowSize int, sample func() (float64, error)) *polledAverage {
+	var w = rolling.NewPointWindow(windowSize)
+	var a = rolling.NewAverageRollup(w, name)
+	return &polledAverage{poller: newPoller(pollingInterval, sample, w), rollup: a}
+}
+
+// polledAggregator applies the fallback policy of a poller to a Rollup that
+// depends on its samples.
+type polledAggregator struct {
+	rolling.Rollup
+	poller *poller
+}
+
+// Aggregate emits the aggregate of the wrapped Aggregator while the poller is
+// healthy and the fallback value otherwise. The wrapped aggregate is
+// reported as the source of the fallback.
+func (p *polledAggregator) Aggregate() *rolling.Aggregate {
+	var a = p.Rollup.Aggregate()
+	if p.poller.healthy() || p.poller.fallback == FallbackHold {
+		return a
+	}
+	var value = 0.0
+	if p.poller.fallback == FallbackFull {
+		value = 1.0
+	}
+	return &rolling.Aggregate{Source: a, Name: "Unhealthy" + p.Name(), Value: value}
+}
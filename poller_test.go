@@ -0,0 +1,242 @@
+package loadshed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// fakeTicker delivers ticks sent by a test.
+type fakeTicker struct {
+	interval time.Duration
+	ticks    chan time.Time
+	stopped  bool
+}
+
+func (f *fakeTicker) C() <-chan time.Time {
+	return f.ticks
+}
+
+func (f *fakeTicker) Stop() {
+	f.stopped = true
+}
+
+// tick delivers a tick and returns once the poller has received it.
+func (f *fakeTicker) tick() {
+	f.ticks <- time.Time{}
+}
+
+// fakeTickers records every Ticker created by a Loadshed.
+type fakeTickers struct {
+	tickers []*fakeTicker
+}
+
+func (f *fakeTickers) NewTicker(interval time.Duration) Ticker {
+	var t = &fakeTicker{interval: interval, ticks: make(chan time.Time)}
+	f.tickers = append(f.tickers, t)
+	return t
+}
+
+// startPoller polls in the background with a real ticker until the test ends.
+func startPoller(t *testing.T, p *poller) {
+	var stop = make(chan struct{})
+	var done = make(chan struct{})
+	p.start(newTimeTicker(p.pollingInterval), stop, func() { close(done) })
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+func TestPolledAverage(t *testing.T) {
+	var values = []float64{1, 2, 3}
+	var p = newPolledAverage("test", time.Second, 3, func() (float64, error) {
+		var v = values[0]
+		values = values[1:]
+		return v, nil
+	})
+	p.feed()
+	p.feed()
+	p.feed()
+	if p.Aggregate().Value != 2 {
+		t.Fatalf("wrong average %f", p.Aggregate().Value)
+	}
+	if p.Name() != "test" {
+		t.Fatalf("wrong name %s", p.Name())
+	}
+}
+
+func TestPolledAverageSkipsErrors(t *testing.T) {
+	var p = newPolledAverage("test", time.Second, 1, func() (float64, error) {
+		return 100, fmt.Errorf("")
+	})
+	p.feed()
+	if p.Aggregate().Value != 0 {
+		t.Fatalf("failed sample was recorded: %f", p.Aggregate().Value)
+	}
+}
+
+func TestPollerReportsErrors(t *testing.T) {
+	var reported []error
+	var names []string
+	var fail = fmt.Errorf("fail")
+	var results = []error{errNoBaseline, fail, nil}
+	var p = newPolledAverage("test", time.Second, 1, func() (float64, error) {
+		var e = results[0]
+		results = results[1:]
+		return 1, e
+	})
+	p.name = "ChanceTest"
+	p.hook = func(name string, e error) {
+		names = append(names, name)
+		reported = append(reported, e)
+	}
+	p.feed()
+	if len(reported) != 0 || !p.healthy() {
+		t.Fatal("missing baseline was reported as a failure")
+	}
+	p.feed()
+	if len(reported) != 1 || reported[0] != fail || names[0] != "ChanceTest" {
+		t.Fatalf("failure was not reported: %v %v", names, reported)
+	}
+	if p.healthy() {
+		t.Fatal("poller with a failed sample is healthy")
+	}
+	p.feed()
+	if !p.healthy() {
+		t.Fatal("poller did not recover")
+	}
+	if len(reported) != 1 {
+		t.Fatalf("unexpected reports %v", reported)
+	}
+}
+
+func TestPollerRecoversPanics(t *testing.T) {
+	var reported error
+	var p = newPolledAverage("test", time.Second, 1, func() (float64, error) {
+		var values []float64
+		return values[0], nil
+	})
+	p.hook = func(name string, e error) { reported = e }
+	p.feed()
+	if reported == nil {
+		t.Fatal("panic was not reported")
+	}
+	if p.Aggregate().Value != 0 {
+		t.Fatalf("failed sample was recorded: %f", p.Aggregate().Value)
+	}
+}
+
+func TestPollerStaleness(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var fail = true
+	var reported []error
+	var p = newPolledAverage("test", time.Second, 1, func() (float64, error) {
+		if fail {
+			return 0, fmt.Errorf("fail")
+		}
+		return 1, nil
+	})
+	p.now = clock.Now
+	p.lastSuccess = clock.Now()
+	p.staleAfter = 3
+	p.hook = func(name string, e error) { reported = append(reported, e) }
+
+	p.feed()
+	clock.Advance(3 * time.Second)
+	if !p.healthy() {
+		t.Fatal("poller became stale before the limit")
+	}
+	clock.Advance(time.Millisecond)
+	if p.healthy() {
+		t.Fatal("poller did not become stale")
+	}
+	if p.healthy() {
+		t.Fatal("poller recovered without a sample")
+	}
+	if len(reported) != 2 || reported[1] != ErrStaleSamples {
+		t.Fatalf("staleness was not reported once: %v", reported)
+	}
+	fail = false
+	p.feed()
+	if !p.healthy() {
+		t.Fatal("poller did not recover")
+	}
+}
+
+func TestPolledAggregatorFallback(t *testing.T) {
+	var tc = []struct {
+		policy   FallbackPolicy
+		expected float64
+	}{
+		{FallbackHold, .5},
+		{FallbackZero, 0},
+		{FallbackFull, 1},
+	}
+	for _, c := range tc {
+		var fail = false
+		var p = newPolledAverage("test", time.Second, 1, func() (float64, error) {
+			if fail {
+				return 0, fmt.Errorf("fail")
+			}
+			return 50, nil
+		})
+		p.fallback = c.policy
+		var a = &polledAggregator{Rollup: rolling.NewPercentageRollup(p, 0, 100, "ChanceTest"), poller: p.poller}
+		p.feed()
+		if a.Aggregate().Value != .5 {
+			t.Fatalf("%d: healthy aggregate was replaced: %f", c.policy, a.Aggregate().Value)
+		}
+		fail = true
+		p.feed()
+		var result = a.Aggregate()
+		if result.Value != c.expected {
+			t.Fatalf("%d: expected %f got %f", c.policy, c.expected, result.Value)
+		}
+		if c.policy != FallbackHold && (result.Name != "UnhealthyChanceTest" || result.Source.Value != .5) {
+			t.Fatalf("%d: unexpected fallback aggregate %s", c.policy, result.Name)
+		}
+	}
+}
+
+func TestPollerStop(t *testing.T) {
+	var samples = 0
+	var p = newPolledAverage("test", time.Second, 1, func() (float64, error) {
+		samples = samples + 1
+		return 1, nil
+	})
+	var ticker = &fakeTicker{ticks: make(chan time.Time)}
+	var stop = make(chan struct{})
+	var done = make(chan struct{})
+	p.start(ticker, stop, func() { close(done) })
+	ticker.tick()
+	close(stop)
+	<-done
+	if !ticker.stopped {
+		t.Fatal("ticker was not stopped")
+	}
+	if samples != 2 {
+		t.Fatalf("wrong number of samples %d", samples)
+	}
+}
+
+func TestPollerIdleIsNotStale(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var p = newPolledAverage("test", time.Second, 1, func() (float64, error) {
+		return 0, errNoBaseline
+	})
+	p.now = clock.Now
+	p.lastSuccess = clock.Now()
+	p.staleAfter = 2
+	p.fallback = FallbackFull
+	var a = &polledAggregator{Rollup: rolling.NewPercentageRollup(p, 0, 100, "ChanceTest"), poller: p.poller}
+	for x := 0; x < 5; x = x + 1 {
+		clock.Advance(time.Second)
+		p.feed()
+		if v := a.Aggregate().Value; v != 0 {
+			t.Fatalf("idle sampler rejected traffic after %d polls: %f", x, v)
+		}
+	}
+}
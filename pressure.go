@@ -0,0 +1,109 @@
+package loadshed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PressureResource identifies a resource tracked by Linux pressure stall
+// information.
+type PressureResource string
+
+const (
+	// PressureCPU is the pressure on CPU.
+	PressureCPU PressureResource = "cpu"
+	// PressureMemory is the pressure on memory.
+	PressureMemory PressureResource = "memory"
+	// PressureIO is the pressure on IO.
+	PressureIO PressureResource = "io"
+)
+
+// PressureMetric identifies one of the running averages in a pressure file.
+// The "some" averages are the percentage of time in which at least one task
+// was stalled on the resource and the "full" averages are the percentage of
+// time in which all non-idle tasks were stalled.
+type PressureMetric string
+
+const (
+	// PressureSomeAvg10 is the "some" average over 10 seconds.
+	PressureSomeAvg10 PressureMetric = "some avg10"
+	// PressureSomeAvg60 is the "some" average over 60 seconds.
+	PressureSomeAvg60 PressureMetric = "some avg60"
+	// PressureSomeAvg300 is the "some" average over 300 seconds.
+	PressureSomeAvg300 PressureMetric = "some avg300"
+	// PressureFullAvg10 is the "full" average over 10 seconds.
+	PressureFullAvg10 PressureMetric = "full avg10"
+	// PressureFullAvg60 is the "full" average over 60 seconds.
+	PressureFullAvg60 PressureMetric = "full avg60"
+	// PressureFullAvg300 is the "full" average over 300 seconds.
+	PressureFullAvg300 PressureMetric = "full avg300"
+)
+
+// defaultPressureRoot is where the kernel exposes system wide pressure stall
+// information.
+const defaultPressureRoot = "/proc/pressure"
+
+// pressurePath returns the system wide pressure file for a resource.
+func pressurePath(resource PressureResource) string {
+	return filepath.Join(defaultPressureRoot, string(resource))
+}
+
+// pressureName generates an aggregate name that identifies the resource and
+// metric read from the pressure file at path, such as PressureCpuSomeAvg10
+// for /proc/pressure/cpu or /sys/fs/cgroup/cpu.pressure.
+func pressureName(path string, metric PressureMetric) string {
+	var resource = strings.TrimSuffix(filepath.Base(path), ".pressure")
+	var name = "Pressure"
+	for _, word := range append([]string{resource}, strings.Fields(string(metric))...) {
+		if word == "" {
+			continue
+		}
+		name = name + strings.ToUpper(word[:1]) + word[1:]
+	}
+	return name
+}
+
+// parsePressure extracts a metric from the content of a pressure file such
+// as:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(content string, metric PressureMetric) (float64, error) {
+	var parts = strings.Fields(string(metric))
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid pressure metric %q", metric)
+	}
+	var kind, key = parts[0], parts[1] + "="
+	for _, line := range strings.Split(content, "\n") {
+		var fields = strings.Fields(line)
+		if len(fields) < 1 || fields[0] != kind {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, key) {
+				continue
+			}
+			var v, e = strconv.ParseFloat(strings.TrimPrefix(field, key), 64)
+			if e != nil {
+				return 0, fmt.Errorf("invalid pressure value %q: %s", field, e)
+			}
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("pressure metric %q not found", metric)
+}
+
+// pressureSample generates a sample function that reads a metric from the
+// pressure file at path.
+func pressureSample(path string, metric PressureMetric) func() (float64, error) {
+	return func() (float64, error) {
+		var b, e = os.ReadFile(path)
+		if e != nil {
+			return 0, e
+		}
+		return parsePressure(string(b), metric)
+	}
+}
@@ -0,0 +1,80 @@
+package loadshed
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const pressureFixture = `some avg10=12.50 avg60=4.25 avg300=1.00 total=123456
+full avg10=3.10 avg60=0.75 avg300=0.10 total=65432
+`
+
+func TestParsePressure(t *testing.T) {
+	var cases = map[PressureMetric]float64{
+		PressureSomeAvg10:  12.5,
+		PressureSomeAvg60:  4.25,
+		PressureSomeAvg300: 1,
+		PressureFullAvg10:  3.1,
+		PressureFullAvg60:  .75,
+		PressureFullAvg300: .1,
+	}
+	for metric, expected := range cases {
+		var v, e = parsePressure(pressureFixture, metric)
+		if e != nil {
+			t.Fatalf("%s: %s", metric, e)
+		}
+		if v != expected {
+			t.Fatalf("%s: expected %f but got %f", metric, expected, v)
+		}
+	}
+}
+
+func TestParsePressureErrors(t *testing.T) {
+	if _, e := parsePressure(pressureFixture, PressureMetric("some")); e == nil {
+		t.Fatal("expected error for invalid metric")
+	}
+	if _, e := parsePressure("some avg10=0.00\n", PressureFullAvg10); e == nil {
+		t.Fatal("expected error for missing line")
+	}
+	if _, e := parsePressure("some avg10=high\n", PressureSomeAvg10); e == nil {
+		t.Fatal("expected error for invalid value")
+	}
+}
+
+func TestPressureSample(t *testing.T) {
+	var root = t.TempDir()
+	writeFixture(t, root, "cpu.pressure", pressureFixture)
+	var p = newPolledAverage("Pressure", time.Second, 1, pressureSample(filepath.Join(root, "cpu.pressure"), PressureSomeAvg10))
+	p.feed()
+	if p.Aggregate().Value != 12.5 {
+		t.Fatalf("wrong pressure %f", p.Aggregate().Value)
+	}
+	var missing = pressureSample(filepath.Join(root, "missing"), PressureSomeAvg10)
+	if _, e := missing(); e == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestPressureName(t *testing.T) {
+	var tc = []struct {
+		path     string
+		metric   PressureMetric
+		expected string
+	}{
+		{pressurePath(PressureCPU), PressureSomeAvg10, "PressureCpuSomeAvg10"},
+		{pressurePath(PressureMemory), PressureFullAvg60, "PressureMemoryFullAvg60"},
+		{"/sys/fs/cgroup/io.pressure", PressureSomeAvg300, "PressureIoSomeAvg300"},
+	}
+	for _, c := range tc {
+		if name := pressureName(c.path, c.metric); name != c.expected {
+			t.Fatalf("expected %s got %s", c.expected, name)
+		}
+	}
+}
+
+func TestPressurePath(t *testing.T) {
+	if pressurePath(PressureMemory) != "/proc/pressure/memory" {
+		t.Fatalf("wrong path %s", pressurePath(PressureMemory))
+	}
+}
@@ -0,0 +1,58 @@
+package loadshed
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	psprocess "github.com/shirou/gopsutil/process"
+)
+
+// processCPUTime reads the total user and system CPU time consumed by the
+// current process.
+func processCPUTime() (time.Duration, error) {
+	var p, e = psprocess.NewProcess(int32(os.Getpid()))
+	if e != nil {
+		return 0, e
+	}
+	var times, terr = p.Times()
+	if terr != nil {
+		return 0, terr
+	}
+	return time.Duration((times.User + times.System) * float64(time.Second)), nil
+}
+
+// processCPUSampler computes the CPU usage of the current process between
+// consecutive calls to sample as a percentage of the available cores.
+type processCPUSampler struct {
+	cores    func() int
+	cpuTime  func() (time.Duration, error)
+	now      func() time.Time
+	last     time.Duration
+	lastTime time.Time
+}
+
+func (s *processCPUSampler) sample() (float64, error) {
+	var now = s.now()
+	var used, e = s.cpuTime()
+	if e != nil {
+		return 0, e
+	}
+	var last, lastTime = s.last, s.lastTime
+	s.last, s.lastTime = used, now
+	var elapsed = now.Sub(lastTime)
+	if lastTime.IsZero() || elapsed <= 0 || used < last {
+		return 0, errNoBaseline
+	}
+	return (used - last).Seconds() / (elapsed.Seconds() * float64(s.cores())) * 100, nil
+}
+
+// newProcessCPUSampler generates a sampler normalised by the given number of
+// cores. If cores is less than one then the current GOMAXPROCS is used.
+func newProcessCPUSampler(cores int) *processCPUSampler {
+	var coresFn = func() int { return runtime.GOMAXPROCS(0) }
+	if cores > 0 {
+		coresFn = func() int { return cores }
+	}
+	return &processCPUSampler{cores: coresFn, cpuTime: processCPUTime, now: time.Now}
+}
@@ -0,0 +1,54 @@
+package loadshed
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestProcessCPUTime(t *testing.T) {
+	var used, e = processCPUTime()
+	if e != nil {
+		t.Skipf("process cpu time not available on this platform: %s", e)
+	}
+	if used < 0 {
+		t.Fatalf("invalid cpu time %s", used)
+	}
+}
+
+func TestProcessCPUSampler(t *testing.T) {
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var used = time.Duration(0)
+	var s = newProcessCPUSampler(4)
+	s.now = clock.Now
+	s.cpuTime = func() (time.Duration, error) { return used, nil }
+
+	if _, e := s.sample(); e != errNoBaseline {
+		t.Fatalf("expected missing baseline: %v", e)
+	}
+	clock.Advance(time.Second)
+	used = 2 * time.Second
+	var v, e = s.sample()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != 50 {
+		t.Fatalf("wrong usage %f", v)
+	}
+}
+
+func TestProcessCPUSamplerError(t *testing.T) {
+	var s = newProcessCPUSampler(1)
+	s.cpuTime = func() (time.Duration, error) { return 0, fmt.Errorf("") }
+	if _, e := s.sample(); e == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestProcessCPUSamplerGOMAXPROCS(t *testing.T) {
+	var s = newProcessCPUSampler(0)
+	if s.cores() != runtime.GOMAXPROCS(0) {
+		t.Fatalf("wrong cores %d", s.cores())
+	}
+}
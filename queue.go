@@ -0,0 +1,42 @@
+package loadshed
+
+import (
+	"github.com/asecurityteam/rolling"
+)
+
+// queueOccupancy is an Aggregator for the occupancy of a bounded queue as a
+// percentage of its capacity. The length of the queue is reported as the
+// source of the aggregate. It is computed each time it is aggregated so no
+// polling is needed.
+type queueOccupancy struct {
+	name  string
+	depth func() (length int, capacity int)
+}
+
+// Name emits the aggregate name for identification.
+func (q *queueOccupancy) Name() string {
+	return q.name
+}
+
+// Aggregate emits the current occupancy of the queue. A queue without
+// capacity, such as an unbuffered channel, is never occupied.
+func (q *queueOccupancy) Aggregate() *rolling.Aggregate {
+	var length, capacity = q.depth()
+	var value = 0.0
+	if capacity > 0 {
+		value = float64(length) / float64(capacity) * 100
+	}
+	return &rolling.Aggregate{
+		Source: &rolling.Aggregate{Name: q.name + "Length", Value: float64(length)},
+		Name:   q.name,
+		Value:  value,
+	}
+}
+
+// ChannelDepth generates a depth function for the Queue option that reports
+// the length and capacity of a buffered channel.
+func ChannelDepth[T any](ch chan T) func() (int, int) {
+	return func() (int, int) {
+		return len(ch), cap(ch)
+	}
+}
@@ -0,0 +1,31 @@
+package loadshed
+
+import (
+	"testing"
+)
+
+func TestQueueOccupancy(t *testing.T) {
+	var length, capacity = 3, 4
+	var q = &queueOccupancy{name: "WorkOccupancy", depth: func() (int, int) { return length, capacity }}
+	var a = q.Aggregate()
+	if a.Value != 75 {
+		t.Fatalf("wrong occupancy %f", a.Value)
+	}
+	if a.Source.Value != 3 || a.Source.Name != "WorkOccupancyLength" {
+		t.Fatalf("wrong source %s %f", a.Source.Name, a.Source.Value)
+	}
+	length, capacity = 0, 0
+	if v := q.Aggregate().Value; v != 0 {
+		t.Fatalf("queue without capacity reported occupancy %f", v)
+	}
+}
+
+func TestChannelDepth(t *testing.T) {
+	var ch = make(chan string, 5)
+	ch <- "a"
+	ch <- "b"
+	var length, capacity = ChannelDepth(ch)()
+	if length != 2 || capacity != 5 {
+		t.Fatalf("wrong channel depth %d/%d", length, capacity)
+	}
+}
@@ -0,0 +1,231 @@
+package loadshed
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+// runtimeSnapshot is a reading of a runtime metric.
+type runtimeSnapshot struct {
+	at      time.Time
+	value   float64
+	counts  []uint64
+	buckets []float64
+}
+
+// readRuntimeMetric reads a single metric from the runtime. An error is
+// returned if the metric is not supported by the running version of Go.
+func readRuntimeMetric(name string) (metrics.Value, error) {
+	var samples = []metrics.Sample{{Name: name}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindBad {
+		return metrics.Value{}, fmt.Errorf("runtime metric %s is not supported", name)
+	}
+	return samples[0].Value, nil
+}
+
+// readRuntimeSnapshot reads a single metric from the runtime as a snapshot.
+func readRuntimeSnapshot(name string) (runtimeSnapshot, error) {
+	var v, e = readRuntimeMetric(name)
+	if e != nil {
+		return runtimeSnapshot{}, e
+	}
+	var s = runtimeSnapshot{at: time.Now()}
+	switch v.Kind() {
+	case metrics.KindUint64:
+		s.value = float64(v.Uint64())
+	case metrics.KindFloat64:
+		s.value = v.Float64()
+	case metrics.KindFloat64Histogram:
+		var h = v.Float64Histogram()
+		s.counts = h.Counts
+		s.buckets = h.Buckets
+	}
+	return s, nil
+}
+
+// Reducer reduces the readings of a runtime metric within a window to a
+// single value. Reducers are created with ReduceLatest, ReduceAverage,
+// ReduceRate, ReducePercentile, and ReduceMean.
+type Reducer struct {
+	name      string
+	histogram bool
+	reduce    func([]runtimeSnapshot) float64
+}
+
+// accepts reports whether the reducer can be used with metrics of the given
+// kind.
+func (r Reducer) accepts(kind metrics.ValueKind) bool {
+	if r.histogram {
+		return kind == metrics.KindFloat64Histogram
+	}
+	return kind == metrics.KindUint64 || kind == metrics.KindFloat64
+}
+
+// ReduceLatest reduces a scalar metric, such as a goroutine count, to its most
+// recent value.
+func ReduceLatest() Reducer {
+	return Reducer{name: "Latest", reduce: func(window []runtimeSnapshot) float64 {
+		return window[len(window)-1].value
+	}}
+}
+
+// ReduceAverage reduces a scalar metric to the average of its values within
+// the window.
+func ReduceAverage() Reducer {
+	return Reducer{name: "Average", reduce: func(window []runtimeSnapshot) float64 {
+		if len(window) > 1 {
+			window = window[1:]
+		}
+		var total = 0.0
+		for _, s := range window {
+			total = total + s.value
+		}
+		return total / float64(len(window))
+	}}
+}
+
+// ReduceRate reduces a cumulative scalar metric, such as a count of
+// allocations, to its rate of change per second within the window.
+func ReduceRate() Reducer {
+	return Reducer{name: "Rate", reduce: func(window []runtimeSnapshot) float64 {
+		var oldest, newest = window[0], window[len(window)-1]
+		var elapsed = newest.at.Sub(oldest.at).Seconds()
+		if elapsed <= 0 {
+			return 0
+		}
+		return (newest.value - oldest.value) / elapsed
+	}}
+}
+
+// ReducePercentile reduces a histogram metric, such as GC pauses, to the given
+// percentile, as N%, of the values recorded within the window.
+func ReducePercentile(percentile float64) Reducer {
+	return Reducer{name: fmt.Sprintf("P%f", percentile), histogram: true, reduce: func(window []runtimeSnapshot) float64 {
+		var newest = window[len(window)-1]
+		return histogramPercentile(histogramDelta(window[0], newest), newest.buckets, percentile)
+	}}
+}
+
+// ReduceMean reduces a histogram metric to the estimated mean of the values
+// recorded within the window. Each value is assumed to be at the midpoint of
+// its bucket.
+func ReduceMean() Reducer {
+	return Reducer{name: "Mean", histogram: true, reduce: func(window []runtimeSnapshot) float64 {
+		var newest = window[len(window)-1]
+		return histogramMean(histogramDelta(window[0], newest), newest.buckets)
+	}}
+}
+
+// histogramDelta computes the counts recorded between two snapshots of a
+// histogram.
+func histogramDelta(oldest runtimeSnapshot, newest runtimeSnapshot) []uint64 {
+	var delta = append([]uint64(nil), newest.counts...)
+	if len(oldest.counts) != len(newest.counts) {
+		return delta
+	}
+	for x := range delta {
+		if oldest.counts[x] <= delta[x] {
+			delta[x] = delta[x] - oldest.counts[x]
+		}
+	}
+	return delta
+}
+
+// histogramPercentile estimates the given percentile, as N%, of a histogram.
+// The upper boundary of the bucket containing the percentile is returned
+// unless it is infinite, in which case the lower boundary is used. Zero is
+// returned for an empty histogram.
+func histogramPercentile(counts []uint64, buckets []float64, percentile float64) float64 {
+	var total uint64
+	for _, c := range counts {
+		total = total + c
+	}
+	if total == 0 {
+		return 0
+	}
+	var rank = math.Ceil(percentile / 100 * float64(total))
+	var seen uint64
+	for x, c := range counts {
+		seen = seen + c
+		if float64(seen) < rank {
+			continue
+		}
+		if !math.IsInf(buckets[x+1], 0) {
+			return buckets[x+1]
+		}
+		return math.Max(0, buckets[x])
+	}
+	return math.Max(0, buckets[len(counts)-1])
+}
+
+// histogramMean estimates the mean of a histogram using the midpoint of each
+// bucket. Buckets with an infinite boundary use their finite boundary. Zero is
+// returned for an empty histogram.
+func histogramMean(counts []uint64, buckets []float64) float64 {
+	var total, sum = 0.0, 0.0
+	for x, c := range counts {
+		if c == 0 {
+			continue
+		}
+		var lower, upper = buckets[x], buckets[x+1]
+		var mid = (lower + upper) / 2
+		switch {
+		case math.IsInf(lower, 0):
+			mid = upper
+		case math.IsInf(upper, 0):
+			mid = lower
+		}
+		total = total + float64(c)
+		sum = sum + mid*float64(c)
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// validateRuntimeMetric checks that the runtime supports the named metric and
+// that the reducer can be used with it.
+func validateRuntimeMetric(name string, reducer Reducer) error {
+	if reducer.reduce == nil {
+		return fmt.Errorf("no reducer given for runtime metric %s", name)
+	}
+	for _, d := range metrics.All() {
+		if d.Name != name {
+			continue
+		}
+		if !reducer.accepts(d.Kind) {
+			return fmt.Errorf("reducer %s cannot be used with runtime metric %s", reducer.name, name)
+		}
+		return nil
+	}
+	return fmt.Errorf("runtime metric %s is not supported", name)
+}
+
+// runtimeMetricSample generates a sample function that reads the named metric
+// and reduces the readings from the last windowSize polls.
+func runtimeMetricSample(name string, reducer Reducer, windowSize int, read func(string) (runtimeSnapshot, error)) func() (float64, error) {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	var window = make([]runtimeSnapshot, 0, windowSize+1)
+	return func() (float64, error) {
+		var s, e = read(name)
+		if e != nil {
+			return 0, e
+		}
+		if len(window) == cap(window) {
+			window = append(window[:0], window[1:]...)
+		}
+		window = append(window, s)
+		return reducer.reduce(window), nil
+	}
+}
+
+// runtimeMetricName generates a name for an aggregate of a runtime metric.
+func runtimeMetricName(name string, reducer Reducer) string {
+	return fmt.Sprintf("%s%s", reducer.name, name)
+}
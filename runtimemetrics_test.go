@@ -0,0 +1,144 @@
+package loadshed
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestReadRuntimeSnapshot(t *testing.T) {
+	var s, e = readRuntimeSnapshot("/sched/goroutines:goroutines")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s.value < 1 {
+		t.Fatalf("wrong goroutine count %f", s.value)
+	}
+	s, e = readRuntimeSnapshot(schedLatencyMetric)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(s.buckets) != len(s.counts)+1 {
+		t.Fatalf("invalid histogram %d buckets %d counts", len(s.buckets), len(s.counts))
+	}
+	if _, e = readRuntimeSnapshot("/not/a/metric:units"); e == nil {
+		t.Fatal("expected error for unknown metric")
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	var buckets = []float64{0, 1, 2, 3, math.Inf(1)}
+	var counts = []uint64{50, 40, 9, 1}
+	var cases = map[float64]float64{
+		50:  1,
+		90:  2,
+		99:  3,
+		100: 3,
+	}
+	for p, expected := range cases {
+		if v := histogramPercentile(counts, buckets, p); v != expected {
+			t.Fatalf("P%f: expected %f but got %f", p, expected, v)
+		}
+	}
+	if v := histogramPercentile([]uint64{0, 0, 0, 0}, buckets, 99); v != 0 {
+		t.Fatalf("expected zero for empty histogram but got %f", v)
+	}
+}
+
+func TestHistogramMean(t *testing.T) {
+	var buckets = []float64{math.Inf(-1), 0, 2, 4, math.Inf(1)}
+	if v := histogramMean([]uint64{0, 1, 1, 0}, buckets); v != 2 {
+		t.Fatalf("wrong mean %f", v)
+	}
+	if v := histogramMean([]uint64{1, 0, 0, 1}, buckets); v != 2 {
+		t.Fatalf("wrong mean with infinite buckets %f", v)
+	}
+	if v := histogramMean([]uint64{0, 0, 0, 0}, buckets); v != 0 {
+		t.Fatalf("expected zero for empty histogram but got %f", v)
+	}
+}
+
+func TestValidateRuntimeMetric(t *testing.T) {
+	if e := validateRuntimeMetric("/sched/goroutines:goroutines", ReduceLatest()); e != nil {
+		t.Fatal(e)
+	}
+	if e := validateRuntimeMetric(schedLatencyMetric, ReducePercentile(99)); e != nil {
+		t.Fatal(e)
+	}
+	if e := validateRuntimeMetric("/sched/goroutines:goroutines", ReduceMean()); e == nil {
+		t.Fatal("expected error for histogram reducer on scalar metric")
+	}
+	if e := validateRuntimeMetric(schedLatencyMetric, ReduceRate()); e == nil {
+		t.Fatal("expected error for scalar reducer on histogram metric")
+	}
+	if e := validateRuntimeMetric("/not/a/metric:units", ReduceLatest()); e == nil {
+		t.Fatal("expected error for unknown metric")
+	}
+	if e := validateRuntimeMetric(schedLatencyMetric, Reducer{}); e == nil {
+		t.Fatal("expected error for missing reducer")
+	}
+}
+
+// fakeRuntimeMetric replays a sequence of snapshots, one second apart.
+func fakeRuntimeMetric(t *testing.T, name string, snapshots []runtimeSnapshot) func(string) (runtimeSnapshot, error) {
+	var at = time.Unix(0, 0)
+	return func(n string) (runtimeSnapshot, error) {
+		if n != name {
+			t.Fatalf("read wrong metric %s", n)
+		}
+		var s = snapshots[0]
+		snapshots = snapshots[1:]
+		s.at = at
+		at = at.Add(time.Second)
+		return s, nil
+	}
+}
+
+func replay(t *testing.T, sample func() (float64, error), expected []float64) {
+	for x, e := range expected {
+		var v, err = sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(v-e) > 1e-9 {
+			t.Fatalf("sample %d: expected %f but got %f", x, e, v)
+		}
+	}
+}
+
+func TestRuntimeMetricScalar(t *testing.T) {
+	var snapshots = []runtimeSnapshot{{value: 10}, {value: 20}, {value: 60}, {value: 60}}
+	replay(t, runtimeMetricSample("m", ReduceLatest(), 2, fakeRuntimeMetric(t, "m", snapshots)), []float64{10, 20, 60, 60})
+	replay(t, runtimeMetricSample("m", ReduceAverage(), 2, fakeRuntimeMetric(t, "m", snapshots)), []float64{10, 20, 40, 60})
+	replay(t, runtimeMetricSample("m", ReduceRate(), 2, fakeRuntimeMetric(t, "m", snapshots)), []float64{0, 10, 25, 20})
+}
+
+func TestRuntimeMetricHistogram(t *testing.T) {
+	var buckets = []float64{0, .001, .01, .1, math.Inf(1)}
+	var snapshots = []runtimeSnapshot{
+		{counts: []uint64{0, 0, 0, 0}, buckets: buckets},
+		{counts: []uint64{90, 10, 0, 0}, buckets: buckets},
+		{counts: []uint64{180, 10, 0, 10}, buckets: buckets},
+	}
+	replay(t, runtimeMetricSample(schedLatencyMetric, ReducePercentile(95), 1, fakeRuntimeMetric(t, schedLatencyMetric, snapshots)), []float64{0, .01, .1})
+	replay(t, runtimeMetricSample(schedLatencyMetric, ReduceMean(), 1, fakeRuntimeMetric(t, schedLatencyMetric, snapshots)), []float64{0, .001, .01045})
+}
+
+func TestRuntimeMetricError(t *testing.T) {
+	var sample = runtimeMetricSample("m", ReduceLatest(), 1, func(string) (runtimeSnapshot, error) {
+		return runtimeSnapshot{}, fmt.Errorf("")
+	})
+	if _, e := sample(); e == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRuntimeMetricRuntime(t *testing.T) {
+	var p = newPolledAverage("test", time.Millisecond, 1, runtimeMetricSample(schedLatencyMetric, ReducePercentile(99), 10, readRuntimeSnapshot))
+	p.feed()
+	p.feed()
+	if v := p.Aggregate().Value; v < 0 || math.IsInf(v, 0) {
+		t.Fatalf("invalid scheduler latency %f", v)
+	}
+}
@@ -0,0 +1,12 @@
+package loadshed
+
+// schedLatencyMetric is the distribution of the time goroutines spend runnable
+// before being scheduled.
+const schedLatencyMetric = "/sched/latencies:seconds"
+
+// schedLatencySample generates a sample function that reports the given
+// percentile, in seconds, of the time goroutines spent runnable before being
+// scheduled within the last windowSize polls.
+func schedLatencySample(read func(string) (runtimeSnapshot, error), percentile float64, windowSize int) func() (float64, error) {
+	return runtimeMetricSample(schedLatencyMetric, ReducePercentile(percentile), windowSize, read)
+}
@@ -0,0 +1,54 @@
+package loadshed
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSchedLatencySample(t *testing.T) {
+	var buckets = []float64{0, .001, .01, .1, math.Inf(1)}
+	var snapshots = [][]uint64{
+		{0, 0, 0, 0},
+		{90, 10, 0, 0},
+		{180, 10, 0, 10},
+	}
+	var read = func(name string) (runtimeSnapshot, error) {
+		if name != schedLatencyMetric {
+			t.Fatalf("read wrong metric %s", name)
+		}
+		var counts = snapshots[0]
+		snapshots = snapshots[1:]
+		return runtimeSnapshot{counts: counts, buckets: buckets}, nil
+	}
+	var sample = schedLatencySample(read, 95, 1)
+	var expected = []float64{0, .01, .1}
+	for _, e := range expected {
+		var v, err = sample()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != e {
+			t.Fatalf("expected %f but got %f", e, v)
+		}
+	}
+}
+
+func TestSchedLatencySampleError(t *testing.T) {
+	var sample = schedLatencySample(func(string) (runtimeSnapshot, error) {
+		return runtimeSnapshot{}, fmt.Errorf("")
+	}, 99, 1)
+	if _, e := sample(); e == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSchedLatencyRuntime(t *testing.T) {
+	var p = newPolledAverage("test", time.Millisecond, 1, schedLatencySample(readRuntimeSnapshot, 99, 10))
+	p.feed()
+	p.feed()
+	if v := p.Aggregate().Value; v < 0 || math.IsInf(v, 0) {
+		t.Fatalf("invalid scheduler latency %f", v)
+	}
+}
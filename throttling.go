@@ -0,0 +1,62 @@
+package loadshed
+
+import (
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// cpuThrottling is an Aggregator for the percentage of CFS enforcement
+// periods in which a cgroup was throttled over a rolling window. The total
+// time spent throttled within the window, in seconds, is reported as the
+// source of the aggregate.
+type cpuThrottling struct {
+	*poller
+	throttled     rolling.Rollup
+	periods       rolling.Rollup
+	throttledTime rolling.Rollup
+}
+
+// Name emits the aggregate name for identification.
+func (c *cpuThrottling) Name() string {
+	return "CPUThrottling"
+}
+
+// Aggregate emits the percentage of throttled periods within the window.
+func (c *cpuThrottling) Aggregate() *rolling.Aggregate {
+	var throttled = c.throttled.Aggregate().Value
+	var periods = c.periods.Aggregate().Value
+	var value = 0.0
+	if periods > 0 {
+		value = throttled / periods * 100
+	}
+	return &rolling.Aggregate{
+		Source: c.throttledTime.Aggregate(),
+		Name:   c.Name(),
+		Value:  value,
+	}
+}
+
+// newCPUThrottling tracks CFS throttling reported by the sampler over a
+// window of windowSize * pollingInterval. The poller must be started
+// separately.
+func newCPUThrottling(sampler *cgroupCPUSampler, pollingInterval time.Duration, windowSize int) *cpuThrottling {
+	var throttled = rolling.NewPointWindow(windowSize)
+	var periods = rolling.NewPointWindow(windowSize)
+	var throttledTime = rolling.NewPointWindow(windowSize)
+	var p = newPoller(pollingInterval, func() (float64, error) {
+		var d, e = sampler.sample()
+		if e != nil {
+			return 0, e
+		}
+		periods.Feed(float64(d.periods))
+		throttledTime.Feed(d.throttledTime.Seconds())
+		return float64(d.throttledPeriods), nil
+	}, throttled)
+	return &cpuThrottling{
+		poller:        p,
+		throttled:     rolling.NewSumRollup(throttled, "CPUThrottledPeriods"),
+		periods:       rolling.NewSumRollup(periods, "CPUPeriods"),
+		throttledTime: rolling.NewSumRollup(throttledTime, "CPUThrottledSeconds"),
+	}
+}
@@ -0,0 +1,84 @@
+package loadshed
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCPUThrottlingV2(t *testing.T) {
+	var root = t.TempDir()
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = newCgroupCPUSampler(root)
+	s.now = clock.Now
+	var c = newCPUThrottling(s, time.Second, 2)
+
+	writeFixture(t, root, "cpu.max", "100000 100000\n")
+	writeCPUFixtureV2(t, root, 0, 0, 0, 0)
+	c.feed()
+	clock.Advance(time.Second)
+	writeCPUFixtureV2(t, root, 500000, 10, 1, 100000)
+	c.feed()
+	clock.Advance(time.Second)
+	writeCPUFixtureV2(t, root, 1000000, 20, 6, 400000)
+	c.feed()
+
+	var a = c.Aggregate()
+	if a.Value != 30 {
+		t.Fatalf("wrong throttling %f", a.Value)
+	}
+	if a.Source == nil || math.Abs(a.Source.Value-.4) > 1e-9 {
+		t.Fatalf("wrong throttled time %+v", a.Source)
+	}
+}
+
+func TestCPUThrottlingV1(t *testing.T) {
+	var root = t.TempDir()
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = newCgroupCPUSampler(root)
+	s.now = clock.Now
+	var c = newCPUThrottling(s, time.Second, 1)
+
+	writeFixture(t, root, "cpu/cpu.cfs_quota_us", "50000\n")
+	writeFixture(t, root, "cpu/cpu.cfs_period_us", "100000\n")
+	writeCPUFixtureV1(t, root, 0, 100, 10, 0)
+	c.feed()
+	clock.Advance(time.Second)
+	writeCPUFixtureV1(t, root, 500000000, 110, 15, 250000000)
+	c.feed()
+
+	var a = c.Aggregate()
+	if a.Value != 50 {
+		t.Fatalf("wrong throttling %f", a.Value)
+	}
+	if a.Source == nil || a.Source.Value != .25 {
+		t.Fatalf("wrong throttled time %+v", a.Source)
+	}
+}
+
+func TestCPUThrottlingInvalidQuota(t *testing.T) {
+	var root = t.TempDir()
+	var clock = &fakeClock{current: time.Unix(0, 0)}
+	var s = newCgroupCPUSampler(root)
+	s.now = clock.Now
+	var c = newCPUThrottling(s, time.Second, 1)
+
+	writeFixture(t, root, "cpu.max", "invalid\n")
+	writeCPUFixtureV2(t, root, 0, 0, 0, 0)
+	c.feed()
+	clock.Advance(time.Second)
+	writeCPUFixtureV2(t, root, 500000, 10, 5, 0)
+	c.feed()
+
+	if c.Aggregate().Value != 50 {
+		t.Fatalf("wrong throttling %f", c.Aggregate().Value)
+	}
+}
+
+func TestCPUThrottlingNoPeriods(t *testing.T) {
+	var c = newCPUThrottling(newCgroupCPUSampler(t.TempDir()), time.Second, 1)
+	c.feed()
+	if c.Aggregate().Value != 0 {
+		t.Fatalf("unexpected throttling %f", c.Aggregate().Value)
+	}
+}
@@ -0,0 +1,53 @@
+package loadshed
+
+import (
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+// throughput is an Aggregator for the rate of calls, per second, within a
+// rolling time window. The number of calls within the window is reported as
+// the source of the aggregate.
+type throughput struct {
+	name     string
+	count    rolling.Rollup
+	duration time.Duration
+}
+
+// Name emits the aggregate name for identification.
+func (t *throughput) Name() string {
+	return t.name
+}
+
+// Aggregate emits the current rate of calls.
+func (t *throughput) Aggregate() *rolling.Aggregate {
+	var count = t.count.Aggregate()
+	return &rolling.Aggregate{
+		Source: count,
+		Name:   t.name,
+		Value:  count.Value / t.duration.Seconds(),
+	}
+}
+
+// newThroughput tracks the rate of calls recorded in the window which spans
+// the given duration.
+func newThroughput(name string, w rolling.Window, duration time.Duration) *throughput {
+	return &throughput{name: name, count: rolling.NewSumRollup(w, name+"Count"), duration: duration}
+}
+
+type throughputDecorator struct {
+	feeder rolling.Feeder
+}
+
+// Track counts the call when it starts so that long running calls are
+// included in the rate as soon as they are admitted.
+func (h *throughputDecorator) Track(cost int) func(error) {
+	h.feeder.Feed(float64(cost))
+	return func(error) {}
+}
+
+// newThroughputDecorator counts admitted calls in the given feeder.
+func newThroughputDecorator(feeder rolling.Feeder) wrapper {
+	return &throughputDecorator{feeder: feeder}
+}
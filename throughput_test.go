@@ -0,0 +1,35 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/rolling"
+)
+
+func TestThroughputDecorator(t *testing.T) {
+	var w = rolling.NewTimeWindow(time.Second, 2, 10)
+	var tp = newThroughput("Throughput", w, 2*time.Second)
+	var decorator = newThroughputDecorator(w)
+	var e = wrap(decorator, 1, func() error {
+		if tp.Aggregate().Value != .5 {
+			t.Fatalf("call was not counted when it started: %f", tp.Aggregate().Value)
+		}
+		return nil
+	})()
+	if e != nil {
+		t.Fatal("Unexpected error")
+	}
+	var done = decorator.Track(3)
+	done(nil)
+	var a = tp.Aggregate()
+	if a.Value != 2 {
+		t.Fatalf("wrong throughput %f", a.Value)
+	}
+	if a.Source.Value != 4 || a.Source.Name != "ThroughputCount" {
+		t.Fatalf("wrong source %s %f", a.Source.Name, a.Source.Value)
+	}
+	if tp.Name() != "Throughput" {
+		t.Fatalf("wrong name %s", tp.Name())
+	}
+}
@@ -0,0 +1,52 @@
+package loadshed
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// Token represents a call admitted by Loadshed.Acquire.
+type Token interface {
+	// Release records the completion of the call. The given error is used to
+	// feed the error rate in the same way as the result of a call made with
+	// Do. Release must be called exactly once.
+	Release(err error)
+}
+
+type token struct {
+	done     func(error)
+	hook     func(error)
+	released int32
+}
+
+func (t *token) Release(err error) {
+	if !atomic.CompareAndSwapInt32(&t.released, 0, 1) {
+		t.report(ErrTokenReleased)
+		return
+	}
+	runtime.SetFinalizer(t, nil)
+	t.done(err)
+}
+
+func (t *token) report(err error) {
+	if t.hook != nil {
+		t.hook(err)
+	}
+}
+
+// leaked releases a token that was garbage collected without being released
+// so that the feeders, and the concurrency count in particular, recover.
+func (t *token) leaked() {
+	if !atomic.CompareAndSwapInt32(&t.released, 0, 1) {
+		return
+	}
+	t.report(ErrTokenLeaked)
+	t.done(ErrTokenLeaked)
+}
+
+// newToken generates a Token that calls done when released.
+func newToken(done func(error), hook func(error)) Token {
+	var t = &token{done: done, hook: hook}
+	runtime.SetFinalizer(t, (*token).leaked)
+	return t
+}
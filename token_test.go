@@ -0,0 +1,64 @@
+package loadshed
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTokenRelease(t *testing.T) {
+	var released error
+	var calls = 0
+	var tk = newToken(func(e error) {
+		calls = calls + 1
+		released = e
+	}, nil)
+	var e = fmt.Errorf("")
+	tk.Release(e)
+	if calls != 1 {
+		t.Fatalf("token released %d times", calls)
+	}
+	if released != e {
+		t.Fatalf("token released with wrong error: %v", released)
+	}
+}
+
+func TestTokenDoubleRelease(t *testing.T) {
+	var calls = 0
+	var reported error
+	var tk = newToken(func(error) { calls = calls + 1 }, func(e error) { reported = e })
+	tk.Release(nil)
+	tk.Release(nil)
+	if calls != 1 {
+		t.Fatalf("token released %d times", calls)
+	}
+	if reported != ErrTokenReleased {
+		t.Fatalf("double release not reported: %v", reported)
+	}
+}
+
+func TestTokenLeaked(t *testing.T) {
+	var reported = make(chan error, 1)
+	var released = make(chan error, 1)
+	func() {
+		_ = newToken(func(e error) { released <- e }, func(e error) { reported <- e })
+	}()
+	var deadline = time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case e := <-reported:
+			if e != ErrTokenLeaked {
+				t.Fatalf("wrong leak error: %v", e)
+			}
+			if e = <-released; e != ErrTokenLeaked {
+				t.Fatalf("leaked token released with wrong error: %v", e)
+			}
+			return
+		case <-deadline:
+			t.Fatal("leaked token was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
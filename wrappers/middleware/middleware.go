@@ -28,18 +28,31 @@ func ErrCodes(errCodes []int) Option {
 	}
 }
 
+// Cost Option installs a function that computes the relative cost of each
+// request, for example from the method, path, or Content-Length. The cost is
+// only used when the load shedder is a loadshed.WeightedDoer or a
+// loadshed.ContextDoer. Without it a loadshed.ContextDoer reads the cost from
+// the context of the request using loadshed.CostFromContext.
+func Cost(cost func(*http.Request) int) Option {
+	return func(m *Middleware) *Middleware {
+		m.cost = cost
+		return m
+	}
+}
+
 // Middleware struct represents a loadshed middleware
 type Middleware struct {
 	next     http.Handler
 	errCodes []int
 	load     loadshed.Doer
 	callback http.Handler
+	cost     func(*http.Request) int
 }
 
 func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var proxy = wrapWriter(w)
 
-	var lerr = m.load.Do(func() error {
+	var lerr = m.do(r, func(r *http.Request) error {
 		m.next.ServeHTTP(proxy, r)
 		for _, errCode := range m.errCodes {
 			if proxy.Status() == errCode {
@@ -56,6 +69,31 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// do runs the request through the most capable interface the load shedder
+// implements. If the load shedder is a loadshed.ContextDoer then the decision
+// that admitted the request is available to the wrapped handler using
+// loadshed.DecisionFromContext.
+func (m *Middleware) do(r *http.Request, run func(*http.Request) error) error {
+	switch l := m.load.(type) {
+	case loadshed.ContextDoer:
+		var ctx = r.Context()
+		if m.cost != nil {
+			ctx = loadshed.NewCostContext(ctx, m.cost(r))
+		}
+		return l.DoContext(ctx, func(ctx context.Context) error {
+			if d := loadshed.DecisionFromContext(ctx); d != nil && d.Degraded {
+				ctx = NewDegradationContext(ctx, d.Probability)
+			}
+			return run(r.WithContext(ctx))
+		})
+	case loadshed.WeightedDoer:
+		if m.cost != nil {
+			return l.DoWeighted(m.cost(r), func() error { return run(r) })
+		}
+	}
+	return m.load.Do(func() error { return run(r) })
+}
+
 func defaultCallback(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusServiceUnavailable)
 }
@@ -78,6 +116,7 @@ func New(l loadshed.Doer, options ...Option) func(http.Handler) http.Handler {
 type ctxKey string
 
 var key = ctxKey("loadshedmiddleware")
+var degradationKey = ctxKey("loadshedmiddlewaredegradation")
 
 // NewContext inserts an aggregate into the context after a request has been
 // rejected.
@@ -94,6 +133,23 @@ func FromContext(ctx context.Context) *rolling.Aggregate {
 	return nil
 }
 
+// NewDegradationContext inserts a degradation level into the context of a
+// request that was admitted in brownout mode.
+func NewDegradationContext(ctx context.Context, level float64) context.Context {
+	return context.WithValue(ctx, degradationKey, level)
+}
+
+// DegradationFromContext extracts the degradation level from the context of
+// a request. A non-zero level means the request would have been rejected but
+// was admitted in brownout mode and should skip optional work. The level is
+// the rejection probability at the time the request was admitted.
+func DegradationFromContext(ctx context.Context) float64 {
+	if v, ok := ctx.Value(degradationKey).(float64); ok {
+		return v
+	}
+	return 0
+}
+
 type codeError struct {
 	errCode int
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/asecurityteam/loadshed"
+	"github.com/asecurityteam/rolling"
 )
 
 func TestMiddleware(t *testing.T) {
@@ -89,6 +90,105 @@ func TestMiddlewareErrorCodeAndError(t *testing.T) {
 	}
 }
 
+func TestMiddlewareCost(t *testing.T) {
+	var l = &fakeWeightedLoadShedder{}
+	var cost = Cost(func(r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return 10
+		}
+		return 1
+	})
+	var middleware = New(l, cost)
+	var handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var r, _ = http.NewRequest(http.MethodPost, "/", nil)
+	var w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("middleware did not call wrapped handler: %d", w.Code)
+	}
+	if l.Cost != 10 {
+		t.Fatalf("middleware did not pass cost: %d", l.Cost)
+	}
+}
+
+func TestMiddlewareCostContext(t *testing.T) {
+	var wg = loadshed.NewWaitGroup()
+	var cost int
+	var middleware = New(loadshed.New(loadshed.Concurrency(100, 200, wg)), Cost(func(*http.Request) int { return 7 }))
+	var handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cost = int(wg.Aggregate().Value)
+	}))
+	var r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	var w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("middleware did not call wrapped handler: %d", w.Code)
+	}
+	if cost != 7 {
+		t.Fatalf("middleware did not pass cost: %d", cost)
+	}
+}
+
+func TestMiddlewareBrownout(t *testing.T) {
+	var w = rolling.NewPointWindow(1)
+	w.Feed(.5)
+	var l = loadshed.New(loadshed.Aggregator(rolling.NewSumRollup(w, "Fixed")), loadshed.Brownout(1))
+	var middleware = New(l)
+	var level float64
+	var handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		level = DegradationFromContext(r.Context())
+	}))
+	var r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	for x := 0; x < 100 && level == 0; x = x + 1 {
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if level != .5 {
+		t.Fatalf("middleware did not expose degradation level: %f", level)
+	}
+}
+
+func TestMiddlewareDecision(t *testing.T) {
+	var w = rolling.NewPointWindow(1)
+	var l = loadshed.New(loadshed.Aggregator(rolling.NewSumRollup(w, "Fixed")))
+	var middleware = New(l)
+	var d *loadshed.Decision
+	var handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d = loadshed.DecisionFromContext(r.Context())
+	}))
+	var r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if d == nil {
+		t.Fatal("middleware did not expose decision")
+	}
+	if d.Aggregate.Name != "Fixed" || d.Probability != 0 {
+		t.Fatalf("middleware exposed wrong decision: %s %f", d.Aggregate.Name, d.Probability)
+	}
+}
+
+func TestMiddlewareNotDegraded(t *testing.T) {
+	var l = loadshed.New()
+	var middleware = New(l)
+	var level = -1.0
+	var handler = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		level = DegradationFromContext(r.Context())
+	}))
+	var r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if level != 0 {
+		t.Fatalf("unexpected degradation level: %f", level)
+	}
+}
+
+type fakeWeightedLoadShedder struct {
+	fakeLoadShedder
+	Cost int
+}
+
+func (f *fakeWeightedLoadShedder) DoWeighted(cost int, run func() error) error {
+	f.Cost = cost
+	return f.Do(run)
+}
+
 type fakeLoadShedder struct {
 	Counter int32
 	err     error
@@ -28,18 +28,31 @@ func Callback(cb func(*http.Request) (*http.Response, error)) Option {
 	}
 }
 
+// Cost option installs a function that computes the relative cost of each
+// request, for example from the method, path, or Content-Length. The cost is
+// only used when the load shedder is a loadshed.WeightedDoer or a
+// loadshed.ContextDoer. Without it a loadshed.ContextDoer reads the cost from
+// the context of the request using loadshed.CostFromContext.
+func Cost(cost func(*http.Request) int) Option {
+	return func(t *Transport) *Transport {
+		t.cost = cost
+		return t
+	}
+}
+
 // Transport is an HTTP client wrapper that provides circuit breaker functionality for
 // the outgoing request.
 type Transport struct {
 	wrapped  http.RoundTripper
 	callback func(*http.Request) (*http.Response, error)
 	load     loadshed.Doer
+	cost     func(*http.Request) int
 }
 
 // RoundTrip circuit breaks the outgoing request if needed and calls the wrapped Client.
 func (c *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
 	var resp *http.Response
-	var e = c.load.Do(func() error {
+	var e = c.do(r, func(r *http.Request) error {
 		var innerResp, innerEr = c.wrapped.RoundTrip(r)
 		if innerEr != nil {
 			return innerEr
@@ -59,6 +72,28 @@ func (c *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
 	return resp, e
 }
 
+// do runs the request through the most capable interface the load shedder
+// implements. If the load shedder is a loadshed.ContextDoer then the decision
+// that admitted the request is available to the wrapped RoundTripper, and on
+// the Request of the returned Response, using loadshed.DecisionFromContext.
+func (c *Transport) do(r *http.Request, run func(*http.Request) error) error {
+	switch l := c.load.(type) {
+	case loadshed.ContextDoer:
+		var ctx = r.Context()
+		if c.cost != nil {
+			ctx = loadshed.NewCostContext(ctx, c.cost(r))
+		}
+		return l.DoContext(ctx, func(ctx context.Context) error {
+			return run(r.WithContext(ctx))
+		})
+	case loadshed.WeightedDoer:
+		if c.cost != nil {
+			return l.DoWeighted(c.cost(r), func() error { return run(r) })
+		}
+	}
+	return c.load.Do(func() error { return run(r) })
+}
+
 // New takes in a loadshed Doer and transport options and returns a RoundTripper wrapper
 func New(l loadshed.Doer, options ...Option) func(c http.RoundTripper) http.RoundTripper {
 	return func(c http.RoundTripper) http.RoundTripper {
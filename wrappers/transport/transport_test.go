@@ -161,6 +161,87 @@ func TestTransportLoadshedder(t *testing.T) {
 	}
 }
 
+type capturingTransport struct {
+	Request *http.Request
+}
+
+func (c *capturingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.Request = r
+	return &http.Response{StatusCode: http.StatusOK, Request: r}, nil
+}
+
+func TestTransportDecision(t *testing.T) {
+	var wrapped = &capturingTransport{}
+	var tr = New(loadshed.New())(wrapped)
+
+	var req, _ = http.NewRequest("GET", "/", ioutil.NopCloser(bytes.NewReader([]byte(``))))
+	var resp, err = tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	var d = loadshed.DecisionFromContext(wrapped.Request.Context())
+	if d == nil {
+		t.Fatal("transport did not expose decision")
+	}
+	if d.Probability != 0 {
+		t.Fatalf("unexpected probability %f", d.Probability)
+	}
+	if loadshed.DecisionFromContext(resp.Request.Context()) != d {
+		t.Fatal("decision not visible on response request")
+	}
+}
+
+func TestTransportCost(t *testing.T) {
+	var l = &fakeWeightedLoadShedder{}
+	var cost = Cost(func(r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return 10
+		}
+		return 1
+	})
+	var tr = New(l, cost)(&capturingTransport{})
+	var req, _ = http.NewRequest(http.MethodPost, "/", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	if l.Cost != 10 {
+		t.Fatalf("transport did not pass cost: %d", l.Cost)
+	}
+}
+
+func TestTransportCostContext(t *testing.T) {
+	var wg = loadshed.NewWaitGroup()
+	var cost int
+	var wrapped = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		cost = int(wg.Aggregate().Value)
+		return &http.Response{StatusCode: http.StatusOK, Request: r}, nil
+	})
+	var tr = New(loadshed.New(loadshed.Concurrency(100, 200, wg)), Cost(func(*http.Request) int { return 7 }))(wrapped)
+	var req, _ = http.NewRequest(http.MethodGet, "/", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	if cost != 7 {
+		t.Fatalf("transport did not pass cost: %d", cost)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+type fakeWeightedLoadShedder struct {
+	fakeLoadShedder
+	Cost int
+}
+
+func (f *fakeWeightedLoadShedder) DoWeighted(cost int, run func() error) error {
+	f.Cost = cost
+	return f.Do(run)
+}
+
 type fakeLoadShedder struct {
 	Counter int32
 	err     error